@@ -0,0 +1,382 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Validation modes of the input.
+const (
+	// ValidateLax ignores the unknown elements of the input (the default).
+	ValidateLax = "lax"
+	// ValidateStrict rejects the inputs with unknown elements.
+	ValidateStrict = "strict"
+)
+
+// Annotation holds the settings of an operation.
+//
+// The annotations are read from the JSON objects (keyed by operation name) in the WSDL's
+// <documentation> elements, for example
+//
+//	{"DbDealer_Login": {"Timeout": "10s", "Roles": ["partner"], "Cache": {"ttl": "5m"}}}
+//
+// and from SOAPHandlerConfig.Annotations (from Go code or a side-car file, see LoadAnnotations),
+// which override the WSDL's annotation of the same operation.
+//
+// The <documentation> may contain any other JSON, too: only the keys naming the operations
+// of the WSDL (or of the Client) are read as annotations, and only those are checked strictly.
+//
+// Raw is set automatically for the operations whose _Input and _Output elements are xs:any.
+type Annotation struct {
+	// Cache the responses of the operation, if the handler has a Cache.
+	Cache *OperationCache `json:",omitempty"`
+	// RateLimit of the operation, unless the RateLimiter has an own limit for it.
+	// A RateLimiter is created if needed.
+	RateLimit *RateLimit `json:",omitempty"`
+	// Roles the caller must have any of ("*" means any token or client certificate caller), checked after the Authorizer.
+	Roles []string `json:",omitempty"`
+	// Validation mode of the input: ValidateLax (the default) or ValidateStrict.
+	Validation string `json:",omitempty"`
+	// Timeout of the call, instead of the handler's Timeout.
+	// In JSON, it is either a time.ParseDuration string ("30s") or seconds.
+	// If set, it must be at least MinTimeout.
+	Timeout time.Duration `json:",omitempty"`
+	// Raw passes the input XML as is, and returns the output as is.
+	Raw bool `json:",omitempty"`
+	// RemoveNS removes the namespace declarations from the raw output.
+	RemoveNS bool `json:",omitempty"`
+	// ForbidMerge returns the parts of the response as they are, without merging them
+	// (as the "Forbid-Merge: 1" request header does).
+	ForbidMerge bool `json:",omitempty"`
+	// KeepEmptyTags keeps the empty elements of the input
+	// (as the "Keep-Empty-Tags: 1" request header does). Needs the SOAPAction header.
+	KeepEmptyTags bool `json:",omitempty"`
+	// Deprecated operations are served with a "Deprecation: true" header, and logged.
+	Deprecated bool `json:",omitempty"`
+}
+
+// UnmarshalJSON decodes the annotation, rejecting the unknown keys.
+func (a *Annotation) UnmarshalJSON(b []byte) error {
+	type plain Annotation
+	var v struct {
+		*plain
+		Timeout json.RawMessage
+	}
+	v.plain = (*plain)(a)
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	var err error
+	a.Timeout, err = parseJSONDuration(v.Timeout)
+	return err
+}
+
+// MinTimeout and MinCacheTTL are the shortest Timeout and Cache TTL allowed in the annotations.
+const (
+	MinTimeout  = 100 * time.Millisecond
+	MinCacheTTL = time.Second
+)
+
+func (a Annotation) validate() error {
+	var errs []error
+	switch a.Validation {
+	case "", ValidateLax, ValidateStrict:
+	default:
+		errs = append(errs, fmt.Errorf("unknown Validation %q", a.Validation))
+	}
+	if a.Timeout != 0 && a.Timeout < MinTimeout {
+		errs = append(errs, fmt.Errorf("too short Timeout %s (< %s)", a.Timeout, MinTimeout))
+	}
+	if a.Cache != nil && a.Cache.TTL != 0 && a.Cache.TTL < MinCacheTTL {
+		errs = append(errs, fmt.Errorf("too short Cache TTL %s (< %s)", a.Cache.TTL, MinCacheTTL))
+	}
+	return errors.Join(errs...)
+}
+
+// parseJSONDuration parses a time.ParseDuration string or a number of seconds (as the Request-Timeout header).
+func parseJSONDuration(b json.RawMessage) (time.Duration, error) {
+	if len(b) == 0 || string(b) == "null" {
+		return 0, nil
+	}
+	if b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return 0, err
+		}
+		return time.ParseDuration(s)
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return 0, err
+	}
+	return parseRequestTimeout(n.String())
+}
+
+// ParseAnnotations parses the annotations (keyed by operation name) from JSON or YAML.
+// Unknown keys are errors.
+//
+//	DbDealer_Login:
+//	  Timeout: 10s
+//	  KeepEmptyTags: true
+//	  RateLimit: {rate: 10, burst: 20}
+func ParseAnnotations(data []byte) (map[string]Annotation, error) {
+	// YAML is a superset of JSON, and the JSON decoding rules apply.
+	var v any
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]Annotation
+	if err = json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadAnnotations reads the annotations from the JSON or YAML file - see ParseAnnotations.
+func LoadAnnotations(path string) (map[string]Annotation, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ParseAnnotations(b)
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", path, err)
+	}
+	return m, nil
+}
+
+// Validate the configuration: the annotations in the WSDL and in Annotations
+// must be well-formed, and the configured ones must be for known operations
+// (of the WSDL or the Client, if any of them lists them).
+//
+// NewSOAPHandler just logs these errors, New returns them.
+func (c SOAPHandlerConfig) Validate() error {
+	_, err := c.annotations()
+	return err
+}
+
+// annotations returns the annotations from the WSDL, overridden by the configured ones.
+func (c SOAPHandlerConfig) annotations() (map[string]Annotation, error) {
+	var errs []error
+	dec := newXMLDecoder(strings.NewReader(c.WSDL))
+	stack := make([]xml.StartElement, 0, 8)
+	names := make(map[string]struct{})
+	var operations []string
+	if c.Client != nil {
+		operations = c.Client.List()
+	}
+	var docs [][]byte
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch x := tok.(type) {
+		case xml.StartElement:
+			if x.Name.Local == "any" && (x.Name.Space == "" || x.Name.Space == "http://www.w3.org/2001/XMLSchema") {
+				if len(stack) >= 3 && stack[len(stack)-1].Name.Local == "sequence" && stack[len(stack)-2].Name.Local == "complexType" && stack[len(stack)-3].Name.Local == "element" {
+					for _, attr := range stack[len(stack)-3].Attr {
+						if attr.Name.Local == "name" {
+							names[attr.Value] = struct{}{}
+						}
+					}
+				}
+			} else if x.Name.Local == "operation" {
+				for _, attr := range x.Attr {
+					if attr.Name.Local == "name" && !slices.Contains(operations, attr.Value) {
+						operations = append(operations, attr.Value)
+					}
+				}
+			}
+			stack = append(stack, x)
+		case xml.CharData:
+			if len(stack) > 1 && stack[len(stack)-1].Name.Local == "documentation" {
+				if x = bytes.TrimSpace(x); bytes.HasPrefix(x, []byte{'{'}) {
+					docs = append(docs, bytes.Clone(x))
+				}
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	isOperation := func(k string) bool {
+		return slices.Contains(operations, k) || slices.Contains(operations, k[strings.LastIndexByte(k, '/')+1:])
+	}
+
+	annotations := make(map[string]Annotation)
+	// the documentation is free-form: only the keys naming operations are annotations
+	for _, doc := range docs {
+		var m map[string]json.RawMessage
+		if json.Unmarshal(doc, &m) != nil {
+			continue
+		}
+		for k, raw := range m {
+			if !isOperation(k) {
+				continue
+			}
+			var a Annotation
+			if err := json.Unmarshal(raw, &a); err != nil {
+				errs = append(errs, fmt.Errorf("parse documentation of %q: %w", k, err))
+				continue
+			}
+			annotations[k] = a
+		}
+	}
+	maps.Copy(annotations, c.Annotations)
+	for nm := range names {
+		k := strings.TrimSuffix(nm, "_Input")
+		if k != nm {
+			if _, ok := names[k+"_Output"]; ok {
+				a := annotations[k]
+				a.Raw = true
+				annotations[k] = a
+			}
+		}
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(annotations)) {
+		if err := annotations[k].validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%q: %w", k, err))
+		}
+		if _, ok := c.Annotations[k]; ok && len(operations) != 0 && !isOperation(k) {
+			errs = append(errs, fmt.Errorf("%q: unknown operation", k))
+		}
+	}
+	return annotations, errors.Join(errs...)
+}
+
+// unknownElement returns the path of the first element under st which has no field in the type of inp,
+// or "" if all the elements are known.
+func unknownElement(dec *xml.Decoder, st xml.StartElement, inp any) (string, error) {
+	return walkElements(dec, st.Name.Local, reflect.TypeOf(inp))
+}
+
+func walkElements(dec *xml.Decoder, path string, t reflect.Type) (string, error) {
+	fields := xmlFields(t)
+	if fields == nil {
+		return "", dec.Skip()
+	}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+		switch x := tok.(type) {
+		case xml.EndElement:
+			return "", nil
+		case xml.StartElement:
+			ft, ok := fields[x.Name.Local]
+			if !ok {
+				return path + "/" + x.Name.Local, nil
+			}
+			if p, err := walkElements(dec, path+"/"+x.Name.Local, ft); p != "" || err != nil {
+				return p, err
+			}
+		}
+	}
+}
+
+var (
+	xmlFieldsCache  sync.Map // reflect.Type -> map[string]reflect.Type
+	xmlUnmarshalerT = reflect.TypeFor[xml.Unmarshaler]()
+)
+
+// xmlFields returns the types of the child elements of t, by element name,
+// as encoding/xml decodes them.
+// Returns nil if t accepts any child element, or it is not a struct.
+func xmlFields(t reflect.Type) map[string]reflect.Type {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || reflect.PointerTo(t).Implements(xmlUnmarshalerT) {
+		return nil
+	}
+	if m, ok := xmlFieldsCache.Load(t); ok {
+		return m.(map[string]reflect.Type)
+	}
+	m := make(map[string]reflect.Type)
+	var collect func(reflect.Type) bool
+	collect = func(t reflect.Type) bool {
+		for i := range t.NumField() {
+			f := t.Field(i)
+			if !f.IsExported() && !f.Anonymous || f.Name == "XMLName" {
+				continue
+			}
+			tag := f.Tag.Get("xml")
+			if tag == "-" {
+				continue
+			}
+			name, flags, _ := strings.Cut(tag, ",")
+			if flags != "" {
+				flags := strings.Split(flags, ",")
+				if slices.Contains(flags, "any") || slices.Contains(flags, "innerxml") {
+					return false
+				}
+				if slices.ContainsFunc(flags, func(s string) bool { return s != "omitempty" }) {
+					continue // attr, chardata, cdata, comment
+				}
+			}
+			if f.Anonymous && name == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					if !collect(ft) {
+						return false
+					}
+					continue
+				}
+			}
+			if strings.Contains(name, ">") {
+				return false
+			}
+			if i := strings.LastIndexByte(name, ' '); i >= 0 {
+				name = name[i+1:]
+			}
+			if name == "" {
+				name = f.Name
+			}
+			m[name] = f.Type
+		}
+		return true
+	}
+	if !collect(t) {
+		m = nil
+	}
+	xmlFieldsCache.Store(t, m)
+	return m
+}
@@ -0,0 +1,153 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+func TestParseAnnotations(t *testing.T) {
+	m, err := ParseAnnotations([]byte(`
+Login:
+  Timeout: 10s
+  KeepEmptyTags: true
+  Roles: [partner]
+  RateLimit: {rate: 10, burst: 20}
+  Cache: {ttl: 5m, shared: true}
+Other: {"Timeout": 30, "Deprecated": true}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	login := m["Login"]
+	if login.Timeout != 10*time.Second || !login.KeepEmptyTags || len(login.Roles) != 1 ||
+		login.RateLimit == nil || login.RateLimit.Burst != 20 ||
+		login.Cache == nil || login.Cache.TTL != 5*time.Minute {
+		t.Errorf("Login: got %+v", login)
+	}
+	if other := m["Other"]; other.Timeout != 30*time.Second || !other.Deprecated {
+		t.Errorf("Other: got %+v", other)
+	}
+
+	for _, bad := range []string{
+		`{"Login": {"Timeout": "10s", "Unknown": true}}`,
+		`Login: {Cache: {ttl: 5m, what: 1}}`,
+		`Login: {Timeout: soon}`,
+		`Login: {Timeout: -1}`,
+		`Login: {Cache: {ttl: 1e300}}`,
+	} {
+		if m, err := ParseAnnotations([]byte(bad)); err == nil {
+			t.Errorf("%s: wanted error, got %+v", bad, m)
+		}
+	}
+}
+
+func TestValidateAnnotations(t *testing.T) {
+	conf := SOAPHandlerConfig{Client: &stubClient{Operations: []string{"Login"}},
+		WSDL:        `<definitions><documentation>{"Login": {"Raw": true}}</documentation></definitions>`,
+		Annotations: map[string]Annotation{"http://example.com/Login": {Timeout: time.Second}},
+	}
+	if err := conf.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	conf.Annotations["Logout"] = Annotation{}
+	conf.Annotations["Login"] = Annotation{Validation: "pedantic"}
+	err := conf.Validate()
+	t.Log(err)
+	if err == nil || !strings.Contains(err.Error(), `"Logout": unknown operation`) || !strings.Contains(err.Error(), "pedantic") {
+		t.Errorf("wanted unknown operation and validation errors, got %+v", err)
+	}
+	delete(conf.Annotations, "Logout")
+	conf.Annotations["Login"] = Annotation{Timeout: 30 * time.Nanosecond, Cache: &OperationCache{TTL: 300 * time.Nanosecond}}
+	err = conf.Validate()
+	t.Log(err)
+	if err == nil || !strings.Contains(err.Error(), "Timeout 30ns") || !strings.Contains(err.Error(), "Cache TTL 300ns") {
+		t.Errorf("wanted too short Timeout and TTL errors, got %+v", err)
+	}
+
+	conf.Annotations = nil
+	conf.WSDL = `<definitions><documentation>{"Login": {"Row": true}}</documentation></definitions>`
+	if _, err = conf.New(); err == nil {
+		t.Error("wanted error for unknown key")
+	}
+
+	// the other JSON in the documentation is not an annotation
+	conf.WSDL = `<definitions><documentation>{"author": "me", "Other": {"Row": 1}}</documentation>
+<documentation>{not JSON}</documentation>
+<portType><operation name="Logout"><documentation>{"Logout": {"Raw": true}}</documentation></operation></portType></definitions>`
+	h, err := conf.New()
+	if err != nil {
+		t.Errorf("free-form documentation: %+v", err)
+	}
+	if !h.annotation("Logout").Raw {
+		t.Errorf("the WSDL's operation is not annotated: %+v", h.annotations)
+	}
+	// the configured annotations may name the WSDL's operations, too
+	conf.Annotations = map[string]Annotation{"Logout": {Deprecated: true}}
+	if err = conf.Validate(); err != nil {
+		t.Errorf("WSDL operation: %+v", err)
+	}
+}
+
+func TestAnnotatedHandler(t *testing.T) {
+	request := strings.Replace(loginRequest, "<PJelszo>", "<PUnknown>x</PUnknown><PJelszo>", 1)
+	for nm, tc := range map[string]struct {
+		Annotation
+		Code int
+	}{
+		"lax":        {Code: http.StatusOK},
+		"strict":     {Annotation: Annotation{Validation: ValidateStrict}, Code: http.StatusInternalServerError},
+		"roles":      {Annotation: Annotation{Roles: []string{"admin"}}, Code: http.StatusForbidden},
+		"deprecated": {Annotation: Annotation{Deprecated: true}, Code: http.StatusOK},
+	} {
+		var cl stubClient
+		h := NewSOAPHandler(SOAPHandlerConfig{Client: &cl, Logger: zlog.NewT(t).SLog(),
+			Annotations: map[string]Annotation{"Login": tc.Annotation}})
+		req := httptest.NewRequest("POST", "/", strings.NewReader(request))
+		req.Header.Set("SOAPAction", "Login")
+		rec := httptest.NewRecorder()
+		h.serveHTTP(rec, req)
+		if rec.Code != tc.Code {
+			t.Errorf("%s: got %d, wanted %d: %s", nm, rec.Code, tc.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Deprecation") == "true"; got != tc.Deprecated {
+			t.Errorf("%s: Deprecation header: got %t", nm, got)
+		}
+		if tc.Code != http.StatusOK && len(cl.Calls(false)) != 0 {
+			t.Errorf("%s: backend called", nm)
+		}
+	}
+}
+
+func TestAnnotationRateLimit(t *testing.T) {
+	h := NewSOAPHandler(SOAPHandlerConfig{Client: &stubClient{}, Logger: zlog.NewT(t).SLog(),
+		Annotations: map[string]Annotation{"Login": {RateLimit: &RateLimit{Rate: 0.001}}}})
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+		req.Header.Set("SOAPAction", "Login")
+		rec := httptest.NewRecorder()
+		h.serveHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%d. got %d, wanted %d", i, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/UNO-SOFT/w3ctrace"
+	"github.com/klauspost/compress/zstd"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultAuditMaxBody is the default maximum size of the request and response envelopes in the AuditRecord.
+const DefaultAuditMaxBody = 1 << 20
+
+// ErrAuditDropped is returned by AsyncAuditSink when its buffer is full.
+var ErrAuditDropped = errors.New("audit record dropped")
+
+// AuditRecord is the structured record of one proxied call.
+type AuditRecord struct {
+	Start      time.Time      `json:"start"`
+	Fault      *SOAPFault     `json:"fault,omitempty"`
+	Operation  string         `json:"operation"`
+	SOAPAction string         `json:"soapAction,omitempty"`
+	TraceID    string         `json:"traceID,omitempty"`
+	Request    string         `json:"request"`
+	Response   string         `json:"response,omitempty"`
+	GRPCCode   string         `json:"grpcCode"`
+	Caller     AuditCaller    `json:"caller"`
+	Durations  AuditDurations `json:"durations"`
+	HTTPStatus int            `json:"httpStatus"`
+	// RequestTruncated and ResponseTruncated are true when the envelope is longer than the configured maximum.
+	RequestTruncated  bool `json:"requestTruncated,omitempty"`
+	ResponseTruncated bool `json:"responseTruncated,omitempty"`
+}
+
+// AuditCaller is the identity of the caller in the AuditRecord.
+type AuditCaller struct {
+	Name       string `json:"name,omitempty"`
+	Method     string `json:"method,omitempty"`
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+}
+
+// AuditDurations are the durations of the phases of the call.
+type AuditDurations struct {
+	Decode time.Duration `json:"decode"`
+	Call   time.Duration `json:"call"`
+	Encode time.Duration `json:"encode"`
+	Total  time.Duration `json:"total"`
+}
+
+// AuditSink receives the AuditRecords.
+type AuditSink interface {
+	Audit(context.Context, AuditRecord) error
+}
+
+// AuditFunc is an AuditSink function.
+type AuditFunc func(context.Context, AuditRecord) error
+
+// Audit implements AuditSink.
+func (f AuditFunc) Audit(ctx context.Context, rec AuditRecord) error { return f(ctx, rec) }
+
+func (h soapHandler) auditMaxBody() int {
+	if h.AuditMaxBody > 0 {
+		return h.AuditMaxBody
+	}
+	return DefaultAuditMaxBody
+}
+
+// audit sends the record of the finished request to the AuditSink.
+func (h soapHandler) audit(ctx context.Context, r *http.Request, start time.Time, stats requestStats, rec *responseRecorder, reqBody, respBody *capBuffer) {
+	caller := CallerFromContext(ctx)
+	ar := AuditRecord{
+		Start: start, Operation: stats.Operation,
+		SOAPAction: strings.Trim(r.Header.Get("SOAPAction"), `"`),
+		Caller:     AuditCaller{Name: caller.Name, Method: caller.Method, RemoteAddr: r.RemoteAddr},
+		Request:    reqBody.String(),
+		GRPCCode:   status.Code(rec.faultErr).String(),
+		Durations: AuditDurations{
+			Decode: stats.Decode, Call: stats.Call, Encode: stats.Encode,
+			Total: time.Since(start),
+		},
+		HTTPStatus:       rec.status,
+		Fault:            rec.fault,
+		RequestTruncated: reqBody.truncated,
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		ar.TraceID = sc.TraceID().String()
+	} else if tr := w3ctrace.FromContext(ctx); tr != nil {
+		ar.TraceID = tr.TraceID.String()
+	}
+	ar.Response, ar.ResponseTruncated = respBody.String(), respBody.truncated
+	if err := h.Audit.Audit(context.WithoutCancel(ctx), h.Redactor.redactAudit(ar)); err != nil {
+		h.getLogger(ctx).Error("audit", "operation", ar.Operation, "error", err)
+	}
+}
+
+// capBuffer is a bytes.Buffer which keeps only the first max bytes.
+type capBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func newCapBuffer(max int) *capBuffer { return &capBuffer{max: max} }
+
+// Write always succeeds, but keeps only the first max bytes.
+func (cb *capBuffer) Write(p []byte) (int, error) {
+	if cb == nil {
+		return len(p), nil
+	}
+	if rest := cb.max - cb.Len(); rest < len(p) {
+		cb.truncated = true
+		cb.Buffer.Write(p[:max(0, rest)])
+		return len(p), nil
+	}
+	return cb.Buffer.Write(p)
+}
+
+func (cb *capBuffer) String() string {
+	if cb == nil {
+		return ""
+	}
+	return cb.Buffer.String()
+}
+
+// FileAuditConfig is the configuration of the FileAuditSink.
+type FileAuditConfig struct {
+	// Dir is the directory of the audit files.
+	Dir string
+	// Prefix of the file names, "audit" by default.
+	Prefix string
+	// MaxSize is the (uncompressed) size after the file is rotated, 64MiB by default.
+	MaxSize int64
+	// MaxAge is the age after the file is rotated, 24h by default.
+	MaxAge time.Duration
+	// Keep this many old files. Zero means keep all.
+	Keep int
+}
+
+// FileAuditSink writes the AuditRecords as zstd-compressed JSON lines into rotated files.
+type FileAuditSink struct {
+	opened time.Time
+	fh     *os.File
+	zw     *zstd.Encoder
+	FileAuditConfig
+	written int64
+	mu      sync.Mutex
+}
+
+// NewFileAuditSink returns a new FileAuditSink, writing into conf.Dir.
+func NewFileAuditSink(conf FileAuditConfig) (*FileAuditSink, error) {
+	if conf.Prefix == "" {
+		conf.Prefix = "audit"
+	}
+	if conf.MaxSize <= 0 {
+		conf.MaxSize = 64 << 20
+	}
+	if conf.MaxAge <= 0 {
+		conf.MaxAge = 24 * time.Hour
+	}
+	if err := os.MkdirAll(conf.Dir, 0750); err != nil {
+		return nil, err
+	}
+	s := FileAuditSink{FileAuditConfig: conf}
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Audit implements AuditSink: writes the record as one JSON line.
+func (s *FileAuditSink) Audit(ctx context.Context, rec AuditRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.zw == nil {
+		return os.ErrClosed
+	}
+	if s.written != 0 && (s.written+int64(len(b)) > s.MaxSize || time.Since(s.opened) > s.MaxAge) {
+		if err = s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.zw.Write(b)
+	s.written += int64(n)
+	if err != nil {
+		return err
+	}
+	return s.zw.Flush()
+}
+
+// rotate closes the current file and opens a new one. Must be called with s.mu held.
+func (s *FileAuditSink) rotate() error {
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+	s.opened = time.Now()
+	fn := filepath.Join(s.Dir, s.Prefix+"-"+s.opened.UTC().Format("20060102T150405.000000000")+".jsonl.zst")
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	zw, err := zstd.NewWriter(fh)
+	if err != nil {
+		fh.Close()
+		return err
+	}
+	s.fh, s.zw, s.written = fh, zw, 0
+	if s.Keep > 0 {
+		old, _ := filepath.Glob(filepath.Join(s.Dir, s.Prefix+"-*.jsonl.zst"))
+		slices.Sort(old)
+		// the current file is the last
+		for len(old) > s.Keep+1 {
+			os.Remove(old[0])
+			old = old[1:]
+		}
+	}
+	return nil
+}
+
+func (s *FileAuditSink) closeFile() error {
+	zw, fh := s.zw, s.fh
+	s.zw, s.fh = nil, nil
+	if zw == nil {
+		return nil
+	}
+	err := zw.Close()
+	if closeErr := fh.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Close the current file.
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeFile()
+}
+
+// AsyncAuditSink buffers the records and sends them to the underlying sink in a separate goroutine,
+// dropping the records when the buffer is full.
+type AsyncAuditSink struct {
+	sink    AuditSink
+	logger  *slog.Logger
+	ch      chan asyncAuditRecord
+	done    chan struct{}
+	dropped atomic.Uint64
+	mu      sync.RWMutex
+	closed  bool
+}
+
+type asyncAuditRecord struct {
+	ctx context.Context
+	AuditRecord
+}
+
+// NewAsyncAuditSink returns an AsyncAuditSink with a buffer of size records.
+func NewAsyncAuditSink(sink AuditSink, size int, logger *slog.Logger) *AsyncAuditSink {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	a := &AsyncAuditSink{sink: sink, logger: logger,
+		ch: make(chan asyncAuditRecord, size), done: make(chan struct{}),
+	}
+	go func() {
+		defer close(a.done)
+		for rec := range a.ch {
+			if err := a.sink.Audit(rec.ctx, rec.AuditRecord); err != nil {
+				a.logger.Error("audit", "operation", rec.Operation, "error", err)
+			}
+		}
+	}()
+	return a
+}
+
+// Audit implements AuditSink, without blocking.
+// After Close, it returns os.ErrClosed.
+func (a *AsyncAuditSink) Audit(ctx context.Context, rec AuditRecord) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return fmt.Errorf("%s: %w", rec.Operation, os.ErrClosed)
+	}
+	select {
+	case a.ch <- asyncAuditRecord{ctx: context.WithoutCancel(ctx), AuditRecord: rec}:
+		return nil
+	default:
+		a.dropped.Add(1)
+		return fmt.Errorf("%s: %w", rec.Operation, ErrAuditDropped)
+	}
+}
+
+// Dropped returns the number of dropped records.
+func (a *AsyncAuditSink) Dropped() uint64 { return a.dropped.Load() }
+
+// Close drains the buffer and closes the underlying sink if it's an io.Closer.
+func (a *AsyncAuditSink) Close() error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.ch)
+	}
+	a.mu.Unlock()
+	<-a.done
+	if c, ok := a.sink.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
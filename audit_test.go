@@ -0,0 +1,145 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/zlog/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestAudit(t *testing.T) {
+	var records []AuditRecord
+	sink := RedactFields(AuditFunc(func(ctx context.Context, rec AuditRecord) error {
+		records = append(records, rec)
+		return nil
+	}), "PJelszo", "AuthToken")
+	h := NewSOAPHandler(SOAPHandlerConfig{Client: &stubClient{}, Logger: zlog.NewT(t).SLog(), Audit: sink})
+	req := httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+	req.Header.Set("SOAPAction", "Login")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.SetBasicAuth("bob", "secret")
+	h.serveHTTP(httptest.NewRecorder(), req)
+
+	if len(records) != 1 {
+		t.Fatalf("got %d records", len(records))
+	}
+	rec := records[0]
+	t.Logf("%+v", rec)
+	if rec.Operation != "Login" || rec.Caller.Name != "bob" || rec.HTTPStatus != 200 || rec.GRPCCode != "OK" {
+		t.Errorf("got %+v", rec)
+	}
+	if rec.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("got trace ID %q", rec.TraceID)
+	}
+	if strings.Contains(rec.Request, "b0917174</PJelszo>") || !strings.Contains(rec.Request, "<PJelszo>***</PJelszo>") ||
+		!strings.Contains(rec.Request, "<PLoginNev>b0917174</PLoginNev>") || strings.Contains(rec.Request, "authToken") {
+		t.Errorf("request not redacted: %s", rec.Request)
+	}
+	if !strings.Contains(rec.Response, "PHibaKod") {
+		t.Errorf("got response %q", rec.Response)
+	}
+	if rec.Durations.Total <= 0 || rec.Durations.Total < rec.Durations.Call {
+		t.Errorf("got durations %+v", rec.Durations)
+	}
+}
+
+func TestFileAuditSink(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileAuditSink(FileAuditConfig{Dir: dir, MaxSize: 100, Keep: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, op := range []string{"a", "b", "c", "d"} {
+		// sleep for distinct file names
+		time.Sleep(time.Millisecond)
+		if err := s.Audit(ctx, AuditRecord{Operation: op, Request: strings.Repeat("x", 50)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "audit-*.jsonl.zst"))
+	if len(files) != 3 {
+		t.Fatalf("got %d files (%q), wanted 3", len(files), files)
+	}
+	var ops []string
+	for _, fn := range files {
+		fh, err := os.Open(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := zstd.NewReader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(zr)
+		for scanner.Scan() {
+			var rec AuditRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				t.Fatal(err)
+			}
+			ops = append(ops, rec.Operation)
+		}
+		zr.Close()
+		fh.Close()
+	}
+	if got := strings.Join(ops, ""); got != "bcd" {
+		t.Errorf("got %q, wanted bcd", got)
+	}
+}
+
+func TestAsyncAuditSink(t *testing.T) {
+	block := make(chan struct{})
+	var got []string
+	a := NewAsyncAuditSink(AuditFunc(func(ctx context.Context, rec AuditRecord) error {
+		<-block
+		got = append(got, rec.Operation)
+		return nil
+	}), 1, zlog.NewT(t).SLog())
+	ctx := context.Background()
+	var dropped int
+	for _, op := range []string{"a", "b", "c", "d"} {
+		if err := a.Audit(ctx, AuditRecord{Operation: op}); errors.Is(err, ErrAuditDropped) {
+			dropped++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(block)
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if dropped == 0 || uint64(dropped) != a.Dropped() || len(got)+dropped != 4 {
+		t.Errorf("got %q, dropped %d (%d)", got, dropped, a.Dropped())
+	}
+	// the in-flight requests may still audit at shutdown
+	if err := a.Audit(ctx, AuditRecord{Operation: "late"}); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Audit after Close: got %+v, wanted os.ErrClosed", err)
+	}
+}
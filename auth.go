@@ -0,0 +1,430 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// ErrUnauthenticated is returned (wrapped) for missing or invalid credentials.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// TokenAuthConfig is the configuration of the "Authorization: Bearer" JWT validation.
+type TokenAuthConfig struct {
+	// ForwardClaims maps claim names to gRPC metadata keys.
+	ForwardClaims map[string]string
+	// JWKSFile is the path of the JSON Web Key Set (RFC 7517) used for verifying the signatures.
+	JWKSFile string
+	// Issuer, if not empty, must match the "iss" claim.
+	Issuer string
+	// RolesClaim is the claim holding the caller's roles ("roles" by default).
+	RolesClaim string
+	// ForwardToken is the gRPC metadata key the raw token is forwarded in (e.g. "authorization").
+	// Empty means the token is not forwarded.
+	ForwardToken string
+	// Audience, if not empty, must have at least one element in the "aud" claim.
+	Audience []string
+	// Leeway is the allowed clock skew for "exp" and "nbf".
+	Leeway time.Duration
+	// Required rejects requests without a Bearer token.
+	Required bool
+}
+
+// TokenValidator validates JWTs locally against a JWKS file.
+type TokenValidator struct {
+	now    func() time.Time
+	keys   map[string]crypto.PublicKey
+	loaded time.Time
+	TokenAuthConfig
+	mu sync.RWMutex
+}
+
+// NewTokenValidator returns a TokenValidator with the keys loaded from conf.JWKSFile.
+func NewTokenValidator(conf TokenAuthConfig) (*TokenValidator, error) {
+	tv := TokenValidator{TokenAuthConfig: conf, now: time.Now}
+	if err := tv.Reload(); err != nil {
+		return nil, err
+	}
+	return &tv, nil
+}
+
+// Reload the JWKS file.
+func (tv *TokenValidator) Reload() error {
+	b, err := os.ReadFile(tv.JWKSFile)
+	if err != nil {
+		return fmt.Errorf("read %q: %w", tv.JWKSFile, err)
+	}
+	keys, err := parseJWKS(b)
+	if err != nil {
+		return fmt.Errorf("parse %q: %w", tv.JWKSFile, err)
+	}
+	tv.mu.Lock()
+	tv.keys, tv.loaded = keys, time.Now()
+	tv.mu.Unlock()
+	return nil
+}
+
+// Claims of a validated JWT.
+type Claims map[string]any
+
+// String returns the named claim as string.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns the named claim as a string slice,
+// accepting both a single string and a list of strings.
+func (c Claims) Strings(name string) []string {
+	switch x := c[name].(type) {
+	case string:
+		return []string{x}
+	case []any:
+		ss := make([]string, 0, len(x))
+		for _, v := range x {
+			if s, ok := v.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+		return ss
+	case []string:
+		return x
+	}
+	return nil
+}
+
+// time returns the named NumericDate claim, the zero time if it is missing.
+// A present, but malformed claim is an error.
+func (c Claims) time(name string) (time.Time, error) {
+	v, ok := c[name]
+	if !ok {
+		return time.Time{}, nil
+	}
+	var f float64
+	switch x := v.(type) {
+	case float64:
+		f = x
+	case json.Number:
+		var err error
+		if f, err = x.Float64(); err != nil {
+			return time.Time{}, fmt.Errorf("%s: %w", name, err)
+		}
+	default:
+		return time.Time{}, fmt.Errorf("%s: %v is not a number", name, v)
+	}
+	if math.IsNaN(f) || math.Abs(f) >= 1<<62 {
+		return time.Time{}, fmt.Errorf("%s: %v is out of range", name, v)
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)), nil
+}
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the Claims of the validated token, if any.
+func ClaimsFromContext(ctx context.Context) Claims {
+	c, _ := ctx.Value(claimsKey{}).(Claims)
+	return c
+}
+
+// Validate the token, returning its claims.
+func (tv *TokenValidator) Validate(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token has %d parts: %w", len(parts), ErrUnauthenticated)
+	}
+	var hdr struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return nil, fmt.Errorf("header: %w: %w", err, ErrUnauthenticated)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("signature: %w: %w", err, ErrUnauthenticated)
+	}
+	key, err := tv.key(hdr.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifySignature(hdr.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, fmt.Errorf("verify: %w: %w", err, ErrUnauthenticated)
+	}
+	var claims Claims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("claims: %w: %w", err, ErrUnauthenticated)
+	}
+	if err = tv.check(claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", err, ErrUnauthenticated)
+	}
+	return claims, nil
+}
+
+func (tv *TokenValidator) check(claims Claims) error {
+	now := tv.now()
+	exp, err := claims.time("exp")
+	if err != nil {
+		return err
+	}
+	if !exp.IsZero() && !now.Before(exp.Add(tv.Leeway)) {
+		return fmt.Errorf("token expired at %s", exp)
+	}
+	nbf, err := claims.time("nbf")
+	if err != nil {
+		return err
+	}
+	if !nbf.IsZero() && now.Add(tv.Leeway).Before(nbf) {
+		return fmt.Errorf("token not valid before %s", nbf)
+	}
+	if tv.Issuer != "" && claims.String("iss") != tv.Issuer {
+		return fmt.Errorf("issuer %q mismatch", claims.String("iss"))
+	}
+	if len(tv.Audience) != 0 {
+		var ok bool
+	Loop:
+		for _, a := range claims.Strings("aud") {
+			for _, want := range tv.Audience {
+				if ok = a == want; ok {
+					break Loop
+				}
+			}
+		}
+		if !ok {
+			return fmt.Errorf("audience %q mismatch", claims.Strings("aud"))
+		}
+	}
+	return nil
+}
+
+// key returns the key with the given ID, reloading the JWKS (at most once a minute) for unknown IDs.
+func (tv *TokenValidator) key(kid string) (crypto.PublicKey, error) {
+	tv.mu.RLock()
+	key, ok := tv.keys[kid]
+	if !ok && kid == "" && len(tv.keys) == 1 {
+		for _, key = range tv.keys {
+			ok = true
+		}
+	}
+	loaded := tv.loaded
+	tv.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if time.Since(loaded) > time.Minute {
+		if err := tv.Reload(); err == nil {
+			tv.mu.RLock()
+			key, ok = tv.keys[kid]
+			tv.mu.RUnlock()
+			if ok {
+				return key, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown key %q: %w", kid, ErrUnauthenticated)
+}
+
+func (tv *TokenValidator) rolesClaim() string {
+	if tv == nil || tv.RolesClaim == "" {
+		return "roles"
+	}
+	return tv.RolesClaim
+}
+
+// authenticate the request: validate the Bearer token (if any),
+// and put the claims into the context, forwarding the configured values as gRPC metadata.
+func (tv *TokenValidator) authenticate(ctx context.Context, r *http.Request) (context.Context, error) {
+	auth := r.Header.Get("Authorization")
+	// the scheme is case-insensitive (RFC 7235)
+	scheme, token, _ := strings.Cut(auth, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		if tv.Required {
+			return ctx, fmt.Errorf("no Bearer token: %w", ErrUnauthenticated)
+		}
+		return ctx, nil
+	}
+	claims, err := tv.Validate(strings.TrimSpace(token))
+	if err != nil {
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, claimsKey{}, claims)
+	kv := make([]string, 0, 2+2*len(tv.ForwardClaims))
+	if tv.ForwardToken != "" {
+		kv = append(kv, tv.ForwardToken, auth)
+	}
+	for claim, key := range tv.ForwardClaims {
+		for _, s := range claims.Strings(claim) {
+			kv = append(kv, key, s)
+		}
+	}
+	if len(kv) != 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, kv...)
+	}
+	return ctx, nil
+}
+
+func decodeSegment(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	if len(alg) != 5 && alg != "EdDSA" {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	}
+	if alg == "EdDSA" {
+		k, ok := key.(ed25519.PublicKey)
+		if !ok || len(k) != ed25519.PublicKeySize {
+			return fmt.Errorf("%s: key is %T", alg, key)
+		}
+		if !ed25519.Verify(k, []byte(signed), sig) {
+			return errors.New("bad signature")
+		}
+		return nil
+	}
+	if hash == 0 || !hash.Available() {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+	switch alg[:2] {
+	case "RS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s: key is %T", alg, key)
+		}
+		return rsa.VerifyPKCS1v15(k, hash, digest, sig)
+	case "PS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s: key is %T", alg, key)
+		}
+		return rsa.VerifyPSS(k, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s: key is %T", alg, key)
+		}
+		n := len(sig) / 2
+		if n == 0 || len(sig) != 2*n {
+			return errors.New("bad signature length")
+		}
+		if !ecdsa.Verify(k, digest, new(big.Int).SetBytes(sig[:n]), new(big.Int).SetBytes(sig[n:])) {
+			return errors.New("bad signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %q", alg)
+}
+
+func parseJWKS(b []byte) (map[string]crypto.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty, Kid, Use string
+			Crv, X, Y     string
+			N, E          string
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	dec := func(s string) *big.Int {
+		b, _ := base64.RawURLEncoding.DecodeString(s)
+		return new(big.Int).SetBytes(b)
+	}
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			keys[k.Kid] = &rsa.PublicKey{N: dec(k.N), E: int(dec(k.E).Int64())}
+		case "EC":
+			var crv elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				crv = elliptic.P256()
+			case "P-384":
+				crv = elliptic.P384()
+			case "P-521":
+				crv = elliptic.P521()
+			default:
+				return nil, fmt.Errorf("%s: unsupported curve %q", k.Kid, k.Crv)
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: crv, X: dec(k.X), Y: dec(k.Y)}
+		case "OKP":
+			if k.Crv != "Ed25519" {
+				return nil, fmt.Errorf("%s: unsupported curve %q", k.Kid, k.Crv)
+			}
+			b, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k.Kid, err)
+			}
+			if len(b) != ed25519.PublicKeySize {
+				continue // skip the bad key, as ed25519.Verify would panic
+			}
+			keys[k.Kid] = ed25519.PublicKey(b)
+		default:
+			return nil, fmt.Errorf("%s: unsupported key type %q", k.Kid, k.Kty)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+	return keys, nil
+}
+
+// authError is an authentication error, mapped to 401 and soapenv:Client fault.
+type authError struct{ error }
+
+func (e authError) Unwrap() error       { return e.error }
+func (e authError) Code() int           { return http.StatusUnauthorized }
+func (e authError) FaultCode() string   { return prefix + ":Client" }
+func (e authError) FaultString() string { return e.Error() }
@@ -0,0 +1,220 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/grpcer"
+	"github.com/UNO-SOFT/zlog/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newTestValidator(t *testing.T) (*TokenValidator, func(Claims) string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA", "kid": "test", "use": "sig",
+		"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	fn := filepath.Join(t.TempDir(), "jwks.json")
+	if err = os.WriteFile(fn, jwks, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tv, err := NewTokenValidator(TokenAuthConfig{
+		JWKSFile: fn, Issuer: "https://idp", Audience: []string{"soap"},
+		ForwardClaims: map[string]string{"sub": "x-subject"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(claims Claims) string {
+		hdr, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+		pl, _ := json.Marshal(claims)
+		signed := b64(hdr) + "." + b64(pl)
+		digest := sha256.Sum256([]byte(signed))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed + "." + b64(sig)
+	}
+	return tv, sign
+}
+
+func TestTokenValidate(t *testing.T) {
+	tv, sign := newTestValidator(t)
+	now := time.Now().Unix()
+	for nm, tc := range map[string]struct {
+		Claims Claims
+		OK     bool
+	}{
+		"ok":       {Claims{"sub": "alice", "iss": "https://idp", "aud": []string{"x", "soap"}, "exp": now + 60}, true},
+		"expired":  {Claims{"sub": "alice", "iss": "https://idp", "aud": "soap", "exp": now - 60}, false},
+		"fracOK":   {Claims{"sub": "alice", "iss": "https://idp", "aud": "soap", "exp": float64(now) + 60.5}, true},
+		"fracExp":  {Claims{"sub": "alice", "iss": "https://idp", "aud": "soap", "exp": float64(now) - 0.5}, false},
+		"badExp":   {Claims{"sub": "alice", "iss": "https://idp", "aud": "soap", "exp": "tomorrow"}, false},
+		"hugeExp":  {Claims{"sub": "alice", "iss": "https://idp", "aud": "soap", "exp": 1e300}, false},
+		"badNbf":   {Claims{"sub": "alice", "iss": "https://idp", "aud": "soap", "nbf": []int{1}}, false},
+		"notYet":   {Claims{"sub": "alice", "iss": "https://idp", "aud": "soap", "nbf": now + 60}, false},
+		"audience": {Claims{"sub": "alice", "iss": "https://idp", "aud": "other"}, false},
+		"issuer":   {Claims{"sub": "alice", "iss": "https://evil", "aud": "soap"}, false},
+	} {
+		claims, err := tv.Validate(sign(tc.Claims))
+		if tc.OK {
+			if err != nil {
+				t.Errorf("%s: %+v", nm, err)
+			} else if got := claims.String("sub"); got != "alice" {
+				t.Errorf("%s: got sub=%q", nm, got)
+			}
+		} else if !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("%s: wanted ErrUnauthenticated, got %+v", nm, err)
+		}
+	}
+
+	tok := sign(Claims{"sub": "alice", "iss": "https://idp", "aud": "soap"})
+	if _, err := tv.Validate(tok[:len(tok)-4] + "AAAA"); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("tampered signature: got %+v", err)
+	}
+}
+
+func TestParseJWKSEd25519(t *testing.T) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	keys, err := parseJWKS([]byte(`{"keys": [
+		{"kty": "OKP", "crv": "Ed25519", "kid": "short", "x": "` + b64([]byte("short")) + `"},
+		{"kty": "OKP", "crv": "Ed25519", "kid": "good", "x": "` + b64(make([]byte, 32)) + `"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := keys["short"]; ok {
+		t.Error("the short key should be skipped")
+	}
+	if _, ok := keys["good"]; !ok {
+		t.Error("the good key is missing")
+	}
+	if err = verifySignature("EdDSA", ed25519.PublicKey("short"), "x.y", []byte("sig")); err == nil {
+		t.Error("short key: wanted error")
+	}
+}
+
+func TestSOAPErrorLegacyAuth(t *testing.T) {
+	for err, code := range map[error]int{
+		status.Error(codes.Unauthenticated, "who are you"):              http.StatusUnauthorized,
+		status.Error(codes.PermissionDenied, "not you"):                 http.StatusUnauthorized,
+		errors.New("bad username or password"):                          http.StatusInternalServerError,
+		status.Error(codes.Unknown, "bad username or password"):         http.StatusInternalServerError,
+		status.Error(codes.Unknown, "lookup: bad username or password"): http.StatusInternalServerError,
+	} {
+		rec := httptest.NewRecorder()
+		soapError(rec, err)
+		if rec.Code != code {
+			t.Errorf("%v: got %d, wanted %d", err, rec.Code, code)
+		}
+	}
+
+	// only with LegacyAuthFault, and only the exact message
+	for _, tc := range []struct {
+		Err    error
+		Legacy bool
+		Code   int
+	}{
+		{status.Error(codes.Unknown, "bad username or password"), false, http.StatusInternalServerError},
+		{status.Error(codes.Unknown, "bad username or password"), true, http.StatusUnauthorized},
+		{status.Error(codes.Unknown, "lookup: bad username or password"), true, http.StatusInternalServerError},
+	} {
+		cl := stubClient{Respond: func(context.Context, string) (grpcer.Receiver, error) { return nil, tc.Err }}
+		h := NewSOAPHandler(SOAPHandlerConfig{Client: &cl, Logger: zlog.NewT(t).SLog(), LegacyAuthFault: tc.Legacy})
+		req := httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+		req.Header.Set("SOAPAction", "Login")
+		rec := httptest.NewRecorder()
+		h.serveHTTP(rec, req)
+		if rec.Code != tc.Code {
+			t.Errorf("%v (legacy=%t): got %d, wanted %d", tc.Err, tc.Legacy, rec.Code, tc.Code)
+		}
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+	tv, sign := newTestValidator(t)
+	var cl stubClient
+	h := NewSOAPHandler(SOAPHandlerConfig{Client: &cl, Logger: zlog.NewT(t).SLog(), TokenAuth: tv})
+
+	for nm, tc := range map[string]struct {
+		Auth string
+		Code int
+	}{
+		"none":  {"", http.StatusOK},
+		"valid": {"Bearer " + sign(Claims{"sub": "bob", "iss": "https://idp", "aud": "soap"}), http.StatusOK},
+		"lower": {"bearer " + sign(Claims{"sub": "bob", "iss": "https://idp", "aud": "soap"}), http.StatusOK},
+		"bad":   {"Bearer " + sign(Claims{"sub": "bob", "iss": "https://idp", "aud": "nope"}), http.StatusUnauthorized},
+	} {
+		cl.Calls(true)
+		req := httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+		req.Header.Set("SOAPAction", "Login")
+		if tc.Auth != "" {
+			req.Header.Set("Authorization", tc.Auth)
+		}
+		rec := httptest.NewRecorder()
+		h.serveHTTP(rec, req)
+		if rec.Code != tc.Code {
+			t.Errorf("%s: got %d, wanted %d: %s", nm, rec.Code, tc.Code, rec.Body.String())
+			continue
+		}
+		if tc.Code != http.StatusOK {
+			if !strings.Contains(rec.Body.String(), "<faultcode>soapenv:Client</faultcode>") {
+				t.Errorf("%s: no Client fault: %s", nm, rec.Body.String())
+			}
+			if len(cl.Calls(false)) != 0 {
+				t.Errorf("%s: backend called", nm)
+			}
+			continue
+		}
+		calls := cl.Calls(false)
+		if len(calls) != 1 {
+			t.Fatalf("%s: got %d calls", nm, len(calls))
+		}
+		md, _ := metadata.FromOutgoingContext(calls[0])
+		if tc.Auth == "" {
+			if ClaimsFromContext(calls[0]) != nil {
+				t.Errorf("%s: claims in context", nm)
+			}
+		} else if got := md.Get("x-subject"); len(got) != 1 || got[0] != "bob" {
+			t.Errorf("%s: got x-subject=%q", nm, got)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// ErrForbidden is returned (wrapped) when the caller is not allowed to call the operation.
+var ErrForbidden = errors.New("forbidden")
+
+// Caller is the identity of the caller.
+type Caller struct {
+	// Claims of the Bearer token, if any.
+	Claims Claims
+	// Name is the token subject, the client certificate's CommonName or the Basic username.
+	Name string
+	// Method is "token", "mtls", "basic" or empty for anonymous callers.
+	// The "basic" Name is NOT verified by the proxy, only by the backend - see Verified.
+	Method string
+	// Roles from the token.
+	Roles []string
+}
+
+// Verified reports whether the proxy has verified the identity of the caller itself:
+// by a valid token or a verified client certificate.
+func (c Caller) Verified() bool { return c.Method == "token" || c.Method == "mtls" }
+
+type callerKey struct{}
+
+// CallerFromContext returns the Caller stored in the context.
+func CallerFromContext(ctx context.Context) Caller {
+	c, _ := ctx.Value(callerKey{}).(Caller)
+	return c
+}
+
+// callerFromRequest returns the identity of the caller, preferring the token, then the client certificate, then Basic auth.
+func callerFromRequest(ctx context.Context, r *http.Request, rolesClaim string) Caller {
+	if claims := ClaimsFromContext(ctx); claims != nil {
+		return Caller{Method: "token", Name: claims.String("sub"), Claims: claims, Roles: claims.Strings(rolesClaim)}
+	}
+	// only the verified client certificates count: with tls.RequestClientCert, anyone can send any certificate
+	if r.TLS != nil && len(r.TLS.VerifiedChains) != 0 && len(r.TLS.VerifiedChains[0]) != 0 {
+		return Caller{Method: "mtls", Name: r.TLS.VerifiedChains[0][0].Subject.CommonName}
+	}
+	if u, _, ok := r.BasicAuth(); ok {
+		return Caller{Method: "basic", Name: u}
+	}
+	return Caller{}
+}
+
+// hasAnyRole reports whether the caller has any of the roles; "*" means any verified caller.
+func (c Caller) hasAnyRole(roles []string) bool {
+	for _, role := range roles {
+		if role == "*" && c.Verified() || slices.Contains(c.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorizer decides whether the caller is allowed to call the operation.
+type Authorizer interface {
+	// Authorize returns nil if caller may call the operation, an error wrapping ErrForbidden otherwise.
+	Authorize(ctx context.Context, operation string, caller Caller) error
+}
+
+// Policy is a declarative, per-operation authorization policy.
+//
+//	{"roles": {"alice": ["admin"], "partner1": ["partner"]},
+//	 "operations": {"*": {"roles": ["admin"]}, "DbDealer_Login": {"anonymous": true}}}
+//
+// WARNING: the proxy does not check the Basic passwords (only the backend does),
+// so anyone knowing a username could pass as that user.
+// Thus the Basic callers are treated as anonymous, unless TrustBasicAuth is set.
+type Policy struct {
+	// Operations maps the operation names (as resolved by DecodeRequest) to rules.
+	// The "*" rule applies to operations without an own rule.
+	Operations map[string]Rule `json:"operations"`
+	// Roles maps caller names (Basic usernames, certificate CommonNames, token subjects) to roles.
+	Roles map[string][]string `json:"roles"`
+	// DefaultAllow allows operations without any matching rule.
+	DefaultAllow bool `json:"defaultAllow,omitempty"`
+	// TrustBasicAuth matches the unverified Basic usernames against the Callers and Roles, too.
+	// Set it only if an upstream component verifies the passwords.
+	TrustBasicAuth bool `json:"trustBasicAuth,omitempty"`
+}
+
+// Rule of an operation: the caller is allowed if it's listed in Callers, or has any of the Roles.
+type Rule struct {
+	// Callers allowed by name.
+	Callers []string `json:"callers,omitempty"`
+	// Roles allowed. "*" means any authenticated caller (Basic ones only with TrustBasicAuth).
+	Roles []string `json:"roles,omitempty"`
+	// Anonymous allows unauthenticated callers, too.
+	Anonymous bool `json:"anonymous,omitempty"`
+}
+
+// Authorize implements Authorizer.
+func (p *Policy) Authorize(ctx context.Context, operation string, caller Caller) error {
+	rule, ok := p.Operations[operation]
+	if !ok {
+		if rule, ok = p.Operations["*"]; !ok {
+			if p.DefaultAllow {
+				return nil
+			}
+			return fmt.Errorf("%q: no rule: %w", operation, ErrForbidden)
+		}
+	}
+	if rule.Anonymous {
+		return nil
+	}
+	if !caller.Verified() && !(caller.Method == "basic" && p.TrustBasicAuth) {
+		return fmt.Errorf("%q: anonymous (or unverified %s) caller: %w", operation, caller.Method, ErrForbidden)
+	}
+	if slices.Contains(rule.Callers, caller.Name) {
+		return nil
+	}
+	for _, role := range rule.Roles {
+		if role == "*" || slices.Contains(caller.Roles, role) || slices.Contains(p.Roles[caller.Name], role) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q: %s caller %q: %w", operation, caller.Method, caller.Name, ErrForbidden)
+}
+
+// PolicyFile is an Authorizer using a Policy loaded from a JSON file, reloadable at runtime.
+type PolicyFile struct {
+	policy  atomic.Pointer[Policy]
+	modTime atomic.Int64
+	Path    string
+}
+
+// NewPolicyFile loads the Policy from the file.
+func NewPolicyFile(path string) (*PolicyFile, error) {
+	pf := PolicyFile{Path: path}
+	if err := pf.Reload(); err != nil {
+		return nil, err
+	}
+	return &pf, nil
+}
+
+// Policy returns the current policy.
+func (pf *PolicyFile) Policy() *Policy { return pf.policy.Load() }
+
+// Authorize implements Authorizer, using the current policy.
+func (pf *PolicyFile) Authorize(ctx context.Context, operation string, caller Caller) error {
+	return pf.policy.Load().Authorize(ctx, operation, caller)
+}
+
+// Reload the policy file. On error, the previous policy remains in effect.
+func (pf *PolicyFile) Reload() error {
+	fh, err := os.Open(pf.Path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	fi, err := fh.Stat()
+	if err != nil {
+		return err
+	}
+	var p Policy
+	dec := json.NewDecoder(fh)
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&p); err != nil {
+		return fmt.Errorf("parse %q: %w", pf.Path, err)
+	}
+	pf.policy.Store(&p)
+	pf.modTime.Store(fi.ModTime().UnixNano())
+	return nil
+}
+
+// Watch the policy file, reloading it when its modification time changes, until the context is canceled.
+func (pf *PolicyFile) Watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fi, err := os.Stat(pf.Path)
+		if err != nil {
+			logger.Warn("stat policy", "path", pf.Path, "error", err)
+			continue
+		}
+		if fi.ModTime().UnixNano() == pf.modTime.Load() {
+			continue
+		}
+		if err = pf.Reload(); err != nil {
+			logger.Error("reload policy", "path", pf.Path, "error", err)
+		} else {
+			logger.Info("policy reloaded", "path", pf.Path)
+		}
+	}
+}
+
+// forbiddenError is an authorization error, mapped to 403 and soapenv:Client fault.
+type forbiddenError struct{ error }
+
+func (e forbiddenError) Unwrap() error       { return e.error }
+func (e forbiddenError) Code() int           { return http.StatusForbidden }
+func (e forbiddenError) FaultCode() string   { return prefix + ":Client" }
+func (e forbiddenError) FaultString() string { return e.Error() }
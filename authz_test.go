@@ -0,0 +1,131 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+func TestPolicy(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(fn, []byte(`{
+  "trustBasicAuth": true,
+  "roles": {"alice": ["admin"], "partner1": ["partner"]},
+  "operations": {
+	"*": {"roles": ["admin"]},
+	"Login": {"roles": ["partner"], "callers": ["bob"]},
+	"Ping": {"anonymous": true}
+  }
+}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pf, err := NewPolicyFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, tc := range []struct {
+		Op     string
+		Caller Caller
+		OK     bool
+	}{
+		{"Ping", Caller{}, true},
+		{"Login", Caller{}, false},
+		{"Login", Caller{Method: "basic", Name: "partner1"}, true},
+		{"Login", Caller{Method: "basic", Name: "bob"}, true},
+		{"Login", Caller{Method: "token", Name: "x", Roles: []string{"partner"}}, true},
+		{"Login", Caller{Method: "mtls", Name: "carol"}, false},
+		{"Other", Caller{Method: "basic", Name: "partner1"}, false},
+		{"Other", Caller{Method: "basic", Name: "alice"}, true},
+	} {
+		err := pf.Authorize(ctx, tc.Op, tc.Caller)
+		if tc.OK && err != nil {
+			t.Errorf("%s by %+v: %+v", tc.Op, tc.Caller, err)
+		} else if !tc.OK && !errors.Is(err, ErrForbidden) {
+			t.Errorf("%s by %+v: wanted ErrForbidden, got %+v", tc.Op, tc.Caller, err)
+		}
+	}
+
+	untrusted := *pf.Policy()
+	untrusted.TrustBasicAuth = false
+	if err = untrusted.Authorize(ctx, "Login", Caller{Method: "basic", Name: "bob"}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("unverified basic caller: wanted ErrForbidden, got %+v", err)
+	}
+
+	h := NewSOAPHandler(SOAPHandlerConfig{Client: &stubClient{}, Logger: zlog.NewT(t).SLog(), Authorizer: pf})
+	for _, tc := range []struct {
+		User string
+		Code int
+	}{{"bob", http.StatusOK}, {"carol", http.StatusForbidden}} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+		req.Header.Set("SOAPAction", "Login")
+		req.SetBasicAuth(tc.User, "secret")
+		rec := httptest.NewRecorder()
+		h.serveHTTP(rec, req)
+		if rec.Code != tc.Code {
+			t.Errorf("%s: got %d, wanted %d: %s", tc.User, rec.Code, tc.Code, rec.Body.String())
+		}
+	}
+
+	// Hot reload
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go pf.Watch(ctx, 10*time.Millisecond, zlog.NewT(t).SLog())
+	future := time.Now().Add(time.Second)
+	if err = os.WriteFile(fn, []byte(`{"operations": {"Login": {"callers": ["carol"]}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(fn, future, future); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && pf.Authorize(ctx, "Login", Caller{Method: "mtls", Name: "carol"}) != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err = pf.Authorize(ctx, "Login", Caller{Method: "mtls", Name: "carol"}); err != nil {
+		t.Errorf("after reload: %+v", err)
+	}
+}
+
+func TestCallerFromRequest(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "carol"}}
+	req := httptest.NewRequest("POST", "/", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if c := callerFromRequest(req.Context(), req, "roles"); c.Method != "" {
+		t.Errorf("unverified certificate: got %+v", c)
+	}
+	req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	if c := callerFromRequest(req.Context(), req, "roles"); c.Method != "mtls" || c.Name != "carol" || !c.Verified() {
+		t.Errorf("verified certificate: got %+v", c)
+	}
+	req.TLS = nil
+	req.SetBasicAuth("bob", "secret")
+	if c := callerFromRequest(req.Context(), req, "roles"); c.Method != "basic" || c.Verified() {
+		t.Errorf("basic: got %+v", c)
+	}
+}
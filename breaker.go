@@ -0,0 +1,250 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned (wrapped) by the calls while the circuit of the destination is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ClientCircuitBreaker is the CircuitBreaker of the SOAPCall* functions, if not nil.
+var ClientCircuitBreaker *CircuitBreaker
+
+// CircuitState is the state of a circuit.
+type CircuitState uint8
+
+const (
+	// CircuitClosed lets the calls through.
+	CircuitClosed = CircuitState(iota)
+	// CircuitOpen fails the calls fast.
+	CircuitOpen
+	// CircuitHalfOpen lets some probe calls through, to decide whether to close or reopen.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", uint8(s))
+}
+
+// CircuitBreaker fails the calls fast when their destination has failed repeatedly,
+// instead of waiting for the timeouts and retries of each call.
+//
+// The circuits are keyed by the destination URL (and the action, if PerAction is set).
+// Each attempt of a call counts, so the retries of a call stop as soon as its circuit opens.
+// The errors and the metrics name the circuits by the host of the URL only,
+// without its userinfo, path and query.
+//
+// The zero value is usable, the fields must not be changed after the first call.
+type CircuitBreaker struct {
+	// IsFailure decides whether the attempt counts as a failure, DefaultCircuitFailure if nil.
+	IsFailure func(Attempt) bool
+	// OnStateChange is called on the state changes of the circuits, with the circuit's label:
+	// the host of the URL (and the action), as in the metrics - never the userinfo of the URL.
+	// It is called with the breaker locked, so it must not call the breaker's methods.
+	OnStateChange func(label string, from, to CircuitState)
+	// Metrics collects the state changes and rejections, ClientMetrics if nil.
+	Metrics *Metrics
+
+	circuits map[string]*circuit
+	now      func() time.Time
+
+	// FailureThreshold is the number of consecutive failures which opens the circuit, 5 by default.
+	FailureThreshold int
+	// SuccessThreshold is the number of successful probes which closes the half-open circuit, 1 by default.
+	SuccessThreshold int
+	// HalfOpenMaxCalls is the number of concurrent probes let through in the half-open state, 1 by default.
+	HalfOpenMaxCalls int
+	// OpenTimeout is the time the circuit stays open before letting probes through, 30s by default.
+	OpenTimeout time.Duration
+
+	mu sync.Mutex
+
+	// PerAction keys the circuits by the destination URL and the action, not just by the URL.
+	PerAction bool
+}
+
+type circuit struct {
+	openedAt            time.Time
+	label               string
+	failures, successes int
+	probes              int
+	state               CircuitState
+}
+
+// DefaultCircuitFailure counts the network errors (but cancellation),
+// and the 5xx responses, except the SOAP faults - those are answers of a working service.
+//
+// The errors of the attempts whose caller's context is done (canceled, or past its deadline)
+// are not counted at all, neither as failure, nor as success: the caller gave up, not the backend.
+func DefaultCircuitFailure(a Attempt) bool {
+	if a.Err != nil {
+		return !errors.Is(a.Err, context.Canceled)
+	}
+	return a.Response != nil && a.Response.StatusCode >= 500 &&
+		(a.FaultCode == "" || a.Response.StatusCode != http.StatusInternalServerError)
+}
+
+// State returns the state of the circuit of the destination (and action, if PerAction).
+func (cb *CircuitBreaker) State(destURL, action string) CircuitState {
+	key := cb.key(destURL, action)
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if c := cb.circuits[key]; c != nil {
+		cb.halfOpen(c)
+		return c.state
+	}
+	return CircuitClosed
+}
+
+func (cb *CircuitBreaker) key(destURL, action string) string {
+	if cb.PerAction {
+		return destURL + " " + action
+	}
+	return destURL
+}
+
+// label of the circuit for the errors and metrics: the host of the URL (and the action).
+func (cb *CircuitBreaker) label(destURL, action string) string {
+	host := "invalid"
+	if u, err := url.Parse(destURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	if cb.PerAction {
+		return host + " " + action
+	}
+	return host
+}
+
+// allow the attempt, if the circuit is not open, returning the function to report its result with.
+// The attempts failing after the caller's ctx is done are not counted.
+func (cb *CircuitBreaker) allow(destURL, action string) (func(context.Context, Attempt), error) {
+	key := cb.key(destURL, action)
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.circuits == nil {
+		cb.circuits = make(map[string]*circuit)
+	}
+	c := cb.circuits[key]
+	if c == nil {
+		c = &circuit{label: cb.label(destURL, action)}
+		cb.circuits[key] = c
+	}
+	cb.halfOpen(c)
+	var probe bool
+	switch c.state {
+	case CircuitOpen:
+		cb.metrics().observeCircuitRejected(c.label)
+		return nil, fmt.Errorf("%s: %w", c.label, ErrCircuitOpen)
+	case CircuitHalfOpen:
+		if c.probes >= max(1, cb.HalfOpenMaxCalls) {
+			cb.metrics().observeCircuitRejected(c.label)
+			return nil, fmt.Errorf("%s: %w", c.label, ErrCircuitOpen)
+		}
+		c.probes++
+		probe = true
+	}
+	return func(ctx context.Context, a Attempt) { cb.done(ctx, c, probe, a) }, nil
+}
+
+func (cb *CircuitBreaker) done(ctx context.Context, c *circuit, probe bool, a Attempt) {
+	isFailure := cb.IsFailure
+	if isFailure == nil {
+		isFailure = DefaultCircuitFailure
+	}
+	failed := isFailure(a)
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if probe {
+		c.probes--
+	}
+	if a.Err != nil && (errors.Is(a.Err, context.Canceled) || ctx.Err() != nil) { // neither success, nor failure
+		return
+	}
+	switch c.state {
+	case CircuitClosed:
+		if !failed {
+			c.failures = 0
+		} else if c.failures++; c.failures >= orDefault(cb.FailureThreshold, 5) {
+			cb.setState(c, CircuitOpen)
+		}
+	case CircuitHalfOpen:
+		if !probe {
+			return
+		}
+		if failed {
+			cb.setState(c, CircuitOpen)
+		} else if c.successes++; c.successes >= orDefault(cb.SuccessThreshold, 1) {
+			cb.setState(c, CircuitClosed)
+		}
+	}
+}
+
+// halfOpen the circuit if it has been open for long enough.
+func (cb *CircuitBreaker) halfOpen(c *circuit) {
+	if c.state == CircuitOpen && cb.timeNow().Sub(c.openedAt) >= orDefault(cb.OpenTimeout, 30*time.Second) {
+		cb.setState(c, CircuitHalfOpen)
+	}
+}
+
+func (cb *CircuitBreaker) setState(c *circuit, state CircuitState) {
+	from := c.state
+	c.state, c.failures, c.successes = state, 0, 0
+	if state == CircuitOpen {
+		c.openedAt = cb.timeNow()
+	}
+	cb.metrics().observeCircuit(c.label, state)
+	if cb.OnStateChange != nil {
+		cb.OnStateChange(c.label, from, state)
+	}
+}
+
+func (cb *CircuitBreaker) metrics() *Metrics {
+	if cb.Metrics == nil {
+		return ClientMetrics
+	}
+	return cb.Metrics
+}
+
+func (cb *CircuitBreaker) timeNow() time.Time {
+	if cb.now != nil {
+		return cb.now()
+	}
+	return time.Now()
+}
+
+// orDefault returns v if it is positive, def otherwise.
+func orDefault[T int | time.Duration](v, def T) T {
+	if v > 0 {
+		return v
+	}
+	return def
+}
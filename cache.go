@@ -0,0 +1,183 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStore stores the cached responses by their keys.
+//
+// The implementations must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns the value stored under the key, if it has not expired yet.
+	Get(key string) ([]byte, bool)
+	// Set stores the value under the key, till expires.
+	Set(key string, value []byte, expires time.Time)
+}
+
+// LRUStore is an in-memory CacheStore, evicting the least recently used entries over its size.
+type LRUStore struct {
+	entries map[string]*list.Element
+	order   list.List
+	size    int
+	mu      sync.Mutex
+}
+
+type lruEntry struct {
+	expires time.Time
+	key     string
+	value   []byte
+}
+
+// NewLRUStore returns an LRUStore keeping at most size entries.
+func NewLRUStore(size int) *LRUStore {
+	return &LRUStore{size: max(1, size), entries: make(map[string]*list.Element)}
+}
+
+// Get the value of the key, if it has not expired yet.
+func (s *LRUStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entries[key]
+	if e == nil {
+		return nil, false
+	}
+	le := e.Value.(*lruEntry)
+	if !time.Now().Before(le.expires) {
+		s.order.Remove(e)
+		delete(s.entries, key)
+		return nil, false
+	}
+	s.order.MoveToFront(e)
+	return le.value, true
+}
+
+// Set the value of the key, till expires.
+func (s *LRUStore) Set(key string, value []byte, expires time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.entries[key]; e != nil {
+		le := e.Value.(*lruEntry)
+		le.value, le.expires = value, expires
+		s.order.MoveToFront(e)
+		return
+	}
+	s.entries[key] = s.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for s.order.Len() > s.size {
+		e := s.order.Back()
+		s.order.Remove(e)
+		delete(s.entries, e.Value.(*lruEntry).key)
+	}
+}
+
+// Len returns the number of the stored entries.
+func (s *LRUStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// DiskStore is a CacheStore keeping the entries in files of a directory,
+// surviving restarts and shareable between processes.
+//
+// The keys must be usable as file names (the caches use hex-encoded hashes).
+type DiskStore struct {
+	dir string
+}
+
+// NewDiskStore returns a DiskStore in dir, creating it if it does not exist.
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	return &DiskStore{dir: dir}, nil
+}
+
+// Get the value of the key, if it has not expired yet.
+func (s *DiskStore) Get(key string) ([]byte, bool) {
+	fn := filepath.Join(s.dir, key)
+	b, err := os.ReadFile(fn)
+	if err != nil || len(b) < 8 {
+		return nil, false
+	}
+	if expires := time.Unix(0, int64(binary.BigEndian.Uint64(b[:8]))); !time.Now().Before(expires) {
+		_ = os.Remove(fn)
+		return nil, false
+	}
+	return b[8:], true
+}
+
+// Set the value of the key, till expires.
+//
+// The file is written atomically; the errors are ignored, as the entry is just not cached.
+func (s *DiskStore) Set(key string, value []byte, expires time.Time) {
+	fh, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(fh.Name())
+	var head [8]byte
+	binary.BigEndian.PutUint64(head[:], uint64(expires.UnixNano()))
+	_, err = fh.Write(head[:])
+	if err == nil {
+		_, err = fh.Write(value)
+	}
+	if closeErr := fh.Close(); err == nil && closeErr == nil {
+		_ = os.Rename(fh.Name(), filepath.Join(s.dir, key))
+	}
+}
+
+// Purge removes the expired entries.
+func (s *DiskStore) Purge() error {
+	now := time.Now()
+	return filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path == s.dir {
+				return nil
+			}
+			return filepath.SkipDir
+		}
+		if strings.HasPrefix(d.Name(), ".tmp-") { // being written
+			return nil
+		}
+		fh, err := os.Open(path)
+		if err != nil {
+			return nil
+		}
+		var head [8]byte
+		_, err = fh.Read(head[:])
+		fh.Close()
+		if err != nil || !now.Before(time.Unix(0, int64(binary.BigEndian.Uint64(head[:])))) {
+			_ = os.Remove(path)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,435 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/UNO-SOFT/grpcer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// captureHeaders are the request headers which affect the processing, thus recorded in the Capture.
+var captureHeaders = []string{"SOAPAction", "Content-Type", "Forbid-Merge", "Keep-Empty-Tags"}
+
+// Capture is the record of one proxied call, written by the handler into SOAPHandlerConfig.CaptureDir,
+// and read by ReplayDir.
+//
+// Captures contain the full, unredacted request and response!
+type Capture struct {
+	Time     time.Time         `json:"time"`
+	Error    *CapturedError    `json:"error,omitempty"`
+	Header   http.Header       `json:"header"`
+	Query    string            `json:"query,omitempty"`
+	Request  string            `json:"request"`
+	Action   string            `json:"action,omitempty"`
+	Response string            `json:"response"`
+	Input    CapturedMessage   `json:"input"`
+	Parts    []CapturedMessage `json:"parts,omitempty"`
+	// StreamError is the error which ended the stream of the parts, if it is not io.EOF.
+	StreamError *CapturedError `json:"streamError,omitempty"`
+	Status      int            `json:"status"`
+	// Cached is set if the response is served from the ServerCache, without a call.
+	Cached bool `json:"cached,omitempty"`
+}
+
+// CapturedMessage is a gRPC message with its type name:
+// the full proto name for proto.Messages, the Go type name for others.
+type CapturedMessage struct {
+	Type  string          `json:"type,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// CapturedError is the error returned by the gRPC call.
+type CapturedError struct {
+	Message string     `json:"message"`
+	Code    codes.Code `json:"code"`
+}
+
+// capture collects the Capture during serveHTTP.
+type capture struct {
+	Capture
+	request, response bytes.Buffer
+}
+
+func newCapture(r *http.Request) *capture {
+	c := capture{Capture: Capture{Time: time.Now(), Header: make(http.Header), Query: r.URL.RawQuery}}
+	for _, k := range captureHeaders {
+		if vv := r.Header.Values(k); len(vv) != 0 {
+			c.Header[http.CanonicalHeaderKey(k)] = vv
+		}
+	}
+	return &c
+}
+
+func (c *capture) setError(err error) { c.Error = captureError(err) }
+
+func captureError(err error) *CapturedError {
+	st := status.Convert(err)
+	return &CapturedError{Code: st.Code(), Message: st.Message()}
+}
+
+// Err returns the gRPC status error.
+func (e *CapturedError) Err() error { return status.Error(e.Code, e.Message) }
+
+// write the Capture as a JSON file into dir.
+func (c *capture) write(dir string, status int) error {
+	c.Request, c.Response, c.Status = c.request.String(), c.response.String(), status
+	b, err := json.MarshalIndent(c.Capture, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	action := c.Action
+	if action == "" {
+		action = "unknown"
+	}
+	fh, err := os.CreateTemp(dir, c.Time.UTC().Format("20060102T150405.000000000")+"-"+filepath.Base(action)+"-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err = fh.Write(b); err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
+
+func captureMessage(v any) CapturedMessage {
+	if v == nil {
+		return CapturedMessage{}
+	}
+	var cm CapturedMessage
+	var err error
+	if m, ok := v.(proto.Message); ok {
+		cm.Type = string(m.ProtoReflect().Descriptor().FullName())
+		cm.Value, err = protojson.Marshal(m)
+	} else {
+		cm.Type = reflect.TypeOf(v).String()
+		cm.Value, err = json.Marshal(v)
+	}
+	if err != nil {
+		cm.Value, _ = json.Marshal(err.Error())
+	}
+	return cm
+}
+
+// captureReceiver records the received parts, and the error ending them.
+type captureReceiver struct {
+	grpcer.Receiver
+	capture *capture
+}
+
+func (cr captureReceiver) Recv() (any, error) {
+	part, err := cr.Receiver.Recv()
+	if err == nil {
+		cr.capture.Parts = append(cr.capture.Parts, captureMessage(part))
+	} else if !errors.Is(err, io.EOF) && cr.capture.StreamError == nil {
+		cr.capture.StreamError = captureError(err)
+	}
+	return part, err
+}
+
+// ReplayResult is the result of replaying a Capture.
+type ReplayResult struct {
+	// Name of the capture file.
+	Name string
+	// InputDiff is the difference of the decoded and the captured input, if any.
+	InputDiff string
+	// Diff is the first difference between the canonicalized produced and captured responses, if any.
+	Diff string
+	// Response is the produced response.
+	Response string
+	Status   int
+	// Identical is true when the produced response is byte-for-byte identical to the captured.
+	Identical bool
+	// Skipped is set for the Cached captures, as there's no call to replay.
+	Skipped bool
+}
+
+// OK reports whether the replay produced the same input, status and (canonically) same response.
+func (rr ReplayResult) OK() bool { return rr.InputDiff == "" && rr.Diff == "" }
+
+// ErrReplayMismatch is returned by ReplayReport if a replay differs from its capture.
+var ErrReplayMismatch = errors.New("replay mismatch")
+
+// ReplayReport replays the captures in dir as ReplayDir, writing the result of each to w,
+// with the canonical difference of the failed ones.
+//
+// It returns ErrReplayMismatch (wrapped) if any replay differs from its capture.
+func ReplayReport(ctx context.Context, conf SOAPHandlerConfig, dir string, newPart func(typeName string) any, w io.Writer) error {
+	results, err := ReplayDir(ctx, conf, dir, newPart)
+	var failed int
+	for _, res := range results {
+		if res.Skipped {
+			fmt.Fprintf(w, "skip\t%s\n", res.Name)
+			continue
+		}
+		if res.OK() {
+			fmt.Fprintf(w, "ok\t%s\n", res.Name)
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "FAIL\t%s\n", res.Name)
+		if res.InputDiff != "" {
+			fmt.Fprintf(w, "\tinput: %s\n", res.InputDiff)
+		}
+		if res.Diff != "" {
+			fmt.Fprintf(w, "\tresponse: %s\n", res.Diff)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d: %w", failed, len(results), ErrReplayMismatch)
+	}
+	return nil
+}
+
+// ReplayDir replays all the captures in dir (as written by the handler with CaptureDir set)
+// through a handler with the given config, whose Client returns the captured gRPC responses,
+// and compares the produced responses with the captured ones.
+//
+// conf.Client is used for the Input and List methods only, and should be the generated Client.
+// newPart returns a new value for the captured type name of a non-proto part;
+// the proto messages are found in protoregistry.GlobalTypes.
+func ReplayDir(ctx context.Context, conf SOAPHandlerConfig, dir string, newPart func(typeName string) any) ([]ReplayResult, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(names)
+	results := make([]ReplayResult, 0, len(names))
+	for _, fn := range names {
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			return results, err
+		}
+		var c Capture
+		if err = json.Unmarshal(b, &c); err != nil {
+			return results, fmt.Errorf("%s: %w", fn, err)
+		}
+		res, err := Replay(ctx, conf, c, newPart)
+		res.Name = filepath.Base(fn)
+		results = append(results, res)
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", fn, err)
+		}
+	}
+	return results, nil
+}
+
+// Replay the Capture through a handler with the given config (without its Cache) - see ReplayDir.
+//
+// The Cached captures are Skipped.
+func Replay(ctx context.Context, conf SOAPHandlerConfig, c Capture, newPart func(typeName string) any) (ReplayResult, error) {
+	if c.Cached {
+		return ReplayResult{Skipped: true}, nil
+	}
+	rc := &replayClient{Client: conf.Client, capture: c, newPart: newPart}
+	conf.Client, conf.CaptureDir, conf.Cache = rc, "", nil
+	h := NewSOAPHandler(conf)
+
+	target := "/"
+	if c.Query != "" {
+		target += "?" + c.Query
+	}
+	req := httptest.NewRequestWithContext(ctx, "POST", target, strings.NewReader(c.Request))
+	for k, vv := range c.Header {
+		for _, v := range vv {
+			req.Header.Add(k, v)
+		}
+	}
+	w := httptest.NewRecorder()
+	h.serveHTTP(w, req)
+
+	res := ReplayResult{Response: w.Body.String(), Status: w.Code}
+	if rc.err != nil {
+		return res, rc.err
+	}
+	res.Identical = res.Response == c.Response && res.Status == c.Status
+	if c.Input.Type != "" {
+		res.InputDiff = jsonDiff(rc.input.Value, c.Input.Value)
+		if rc.input.Type != c.Input.Type {
+			res.InputDiff = fmt.Sprintf("got type %q, wanted %q", rc.input.Type, c.Input.Type)
+		}
+	}
+	if !res.Identical {
+		if res.Status != c.Status {
+			res.Diff = fmt.Sprintf("got status %d, wanted %d", res.Status, c.Status)
+		} else {
+			res.Diff = xmlDiff(res.Response, c.Response)
+		}
+	}
+	return res, nil
+}
+
+// replayClient returns the captured response, recording the got input.
+type replayClient struct {
+	grpcer.Client
+	err     error
+	newPart func(string) any
+	input   CapturedMessage
+	capture Capture
+}
+
+func (rc *replayClient) Call(name string, ctx context.Context, input any, opts ...grpc.CallOption) (grpcer.Receiver, error) {
+	rc.input = captureMessage(input)
+	if e := rc.capture.Error; e != nil {
+		return nil, e.Err()
+	}
+	parts := make([]any, 0, len(rc.capture.Parts))
+	for _, cm := range rc.capture.Parts {
+		part, err := rc.newMessage(cm)
+		if err != nil {
+			rc.err = fmt.Errorf("%s: %w", cm.Type, err)
+			return nil, rc.err
+		}
+		parts = append(parts, part)
+	}
+	sr := sliceReceiver{parts: parts}
+	if e := rc.capture.StreamError; e != nil {
+		sr.err = e.Err()
+	}
+	return &sr, nil
+}
+
+func (rc *replayClient) newMessage(cm CapturedMessage) (any, error) {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(cm.Type)); err == nil {
+		m := mt.New().Interface()
+		return m, protojson.Unmarshal(cm.Value, m)
+	}
+	if rc.newPart == nil {
+		return nil, errors.New("unknown type")
+	}
+	v := rc.newPart(cm.Type)
+	if v == nil {
+		return nil, errors.New("unknown type")
+	}
+	return v, json.Unmarshal(cm.Value, v)
+}
+
+// sliceReceiver returns the parts one by one, then err (io.EOF if nil).
+type sliceReceiver struct {
+	err   error
+	parts []any
+}
+
+func (sr *sliceReceiver) Recv() (any, error) {
+	if len(sr.parts) == 0 {
+		if sr.err == nil {
+			return nil, io.EOF
+		}
+		return nil, sr.err
+	}
+	part := sr.parts[0]
+	sr.parts = sr.parts[1:]
+	return part, nil
+}
+
+// jsonDiff returns a non-empty string if the two JSON differ semantically.
+func jsonDiff(got, want json.RawMessage) string {
+	var g, w any
+	if json.Unmarshal(got, &g) != nil || json.Unmarshal(want, &w) != nil {
+		if bytes.Equal(got, want) {
+			return ""
+		}
+	} else if reflect.DeepEqual(g, w) {
+		return ""
+	}
+	return fmt.Sprintf("got %s, wanted %s", got, want)
+}
+
+// xmlDiff returns the first difference of the canonicalized XMLs, or "" if they're the same.
+func xmlDiff(got, want string) string {
+	g, gErr := canonicalXML(got)
+	w, wErr := canonicalXML(want)
+	if gErr != nil || wErr != nil {
+		g, w = got, want
+	}
+	if g == w {
+		return ""
+	}
+	i := 0
+	for i < len(g) && i < len(w) && g[i] == w[i] {
+		i++
+	}
+	from := max(0, i-64)
+	return fmt.Sprintf("at %d: got %q, wanted %q", i, g[from:min(len(g), i+64)], w[from:min(len(w), i+64)])
+}
+
+// canonicalXML returns the XML with the namespaces resolved, the attributes sorted,
+// and the comments, processing instructions and the whitespace between the elements removed.
+func canonicalXML(s string) (string, error) {
+	dec := xml.NewDecoder(strings.NewReader(s))
+	var buf strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return buf.String(), nil
+			}
+			return buf.String(), err
+		}
+		switch x := tok.(type) {
+		case xml.StartElement:
+			buf.WriteString("<{" + x.Name.Space + "}" + x.Name.Local)
+			attrs := make([]string, 0, len(x.Attr))
+			for _, a := range x.Attr {
+				if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" && a.Name.Space == "" {
+					continue
+				}
+				var ab strings.Builder
+				ab.WriteString(" {" + a.Name.Space + "}" + a.Name.Local + `="`)
+				_ = xml.EscapeText(&ab, []byte(a.Value))
+				ab.WriteByte('"')
+				attrs = append(attrs, ab.String())
+			}
+			slices.Sort(attrs)
+			buf.WriteString(strings.Join(attrs, ""))
+			buf.WriteByte('>')
+		case xml.EndElement:
+			buf.WriteString("</{" + x.Name.Space + "}" + x.Name.Local + ">")
+		case xml.CharData:
+			if len(bytes.TrimSpace(x)) != 0 {
+				_ = xml.EscapeText(&buf, x)
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/grpcer"
+	"github.com/UNO-SOFT/zlog/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCaptureReplay(t *testing.T) {
+	dir := t.TempDir()
+	conf := SOAPHandlerConfig{Client: &stubClient{}, Logger: zlog.NewT(t).SLog()}
+	capConf := conf
+	capConf.CaptureDir = dir
+	h := NewSOAPHandler(capConf)
+	req := httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+	req.Header.Set("SOAPAction", "Login")
+	req.SetBasicAuth("bob", "secret")
+	h.serveHTTP(httptest.NewRecorder(), req)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("got %d captures", len(files))
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c Capture
+	if err = json.Unmarshal(b, &c); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%+v", c)
+	if c.Action != "Login" || c.Status != 200 || len(c.Parts) != 1 || c.Parts[0].Type != "*soapproxy.loginOutput" ||
+		c.Request != loginRequest || !strings.Contains(c.Response, "PHibaKod") || c.Header.Get("Authorization") != "" {
+		t.Fatalf("got %+v", c)
+	}
+
+	newPart := func(typ string) any {
+		if typ == "*soapproxy.loginOutput" {
+			return &loginOutput{}
+		}
+		return nil
+	}
+	results, err := ReplayDir(context.Background(), conf, dir, newPart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].OK() || !results[0].Identical {
+		t.Errorf("got %+v", results)
+	}
+
+	// reformatting is canonically the same
+	c.Response = strings.Replace(c.Response, "<PHibaKod>", "\n  <PHibaKod >", 1)
+	if res, err := Replay(context.Background(), conf, c, newPart); err != nil {
+		t.Fatal(err)
+	} else if !res.OK() || res.Identical {
+		t.Errorf("got %+v", res)
+	}
+	c.Response = strings.Replace(c.Response, ">0<", ">1<", 1)
+	if res, err := Replay(context.Background(), conf, c, newPart); err != nil {
+		t.Fatal(err)
+	} else if res.OK() {
+		t.Errorf("no diff found: %+v", res)
+	} else {
+		t.Log(res.Diff)
+	}
+
+	c.Parts[0].Type = "unknown"
+	if _, err := Replay(context.Background(), conf, c, newPart); err == nil {
+		t.Error("wanted error for unknown part type")
+	}
+
+	// the error ending the stream is replayed, the cached responses are skipped
+	var streamErr error
+	conf.Client = &stubClient{Respond: func(context.Context, string) (grpcer.Receiver, error) {
+		return &stubRecv{Parts: []any{&loginOutput{}}, Err: streamErr}, nil
+	}}
+	capConf = conf
+	for nm, tc := range map[string]struct {
+		Err      error
+		OK, Skip int
+	}{
+		"stream error": {Err: status.Error(codes.Unavailable, "gone"), OK: 2}, // not cached
+		"cached":       {OK: 1, Skip: 1},
+	} {
+		streamErr, capConf.CaptureDir = tc.Err, t.TempDir()
+		capConf.Cache = NewServerCache(ServerCacheConfig{Operations: map[string]OperationCache{"Login": {TTL: time.Minute}}})
+		h := NewSOAPHandler(capConf)
+		for range 2 {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+			req.Header.Set("SOAPAction", "Login")
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: "carol"}}
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+			h.serveHTTP(httptest.NewRecorder(), req)
+		}
+		var buf strings.Builder
+		err := ReplayReport(context.Background(), conf, capConf.CaptureDir, newPart, &buf)
+		got := buf.String()
+		t.Logf("%s: %s", nm, got)
+		if err != nil {
+			t.Errorf("%s: %+v", nm, err)
+		} else if strings.Count(got, "ok\t") != tc.OK || strings.Count(got, "skip\t") != tc.Skip {
+			t.Errorf("%s: got %s, wanted %d ok and %d skipped", nm, got, tc.OK, tc.Skip)
+		}
+	}
+}
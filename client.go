@@ -24,11 +24,15 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/klauspost/compress/gzhttp"
 	"github.com/rogpeppe/retry"
 	"github.com/tgulacsi/go/iohlp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"log/slog"
 )
 
@@ -48,94 +52,146 @@ const (
 	SOAPHeader = `<?xml version="1.0" encoding="utf-8"?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Header>`
 	SOAPBody   = `</soapenv:Header><soapenv:Body>`
 	SOAPFooter = `</soapenv:Body></soapenv:Envelope>`
+
+	soap12Header      = `<?xml version="1.0" encoding="utf-8"?><soapenv:Envelope xmlns:soapenv="` + soap12EnvelopeURI + `"><soapenv:Header>`
+	soap12EnvelopeURI = "http://www.w3.org/2003/05/soap-envelope"
 )
 
-// SOAPCallWithHeader calls with the given SOAP- and extra header and action.
-func SOAPCallWithHeaderClient(ctx context.Context,
-	client *http.Client,
-	destURL string,
-	customizeRequest func(req *http.Request), customizeResponse func(resp *http.Response),
-	action, soapHeader, reqBody string, resp any,
-	logger *slog.Logger,
-) error {
-	buf := bufPool.Get().(*bytes.Buffer)
-	defer func() {
-		buf.Reset()
-		bufPool.Put(buf)
-	}()
-	buf.WriteString(SOAPHeader)
-	buf.WriteString(soapHeader)
-	buf.WriteString(SOAPBody)
-	buf.WriteString(reqBody)
-	buf.WriteString(SOAPFooter)
+// SOAPVersion is the version of the SOAP protocol the Client speaks.
+type SOAPVersion uint8
 
-	if client == nil {
-		client = http.DefaultClient
-	}
-	if client.Transport == nil {
-		client.Transport = http.DefaultTransport
-	}
-	client.Transport = gzhttp.Transport(client.Transport)
-	retryStrategy := retryStrategy
-	if dl, ok := ctx.Deadline(); ok {
-		if d := time.Until(dl); d > time.Second {
-			retryStrategy.MaxDuration = d
-		}
-	}
-	var response *http.Response
-	var dur time.Duration
-	var tryCount int
-	reqHead, reqTail := splitHeadTail(buf.Bytes(), 1024)
-	for iter := retryStrategy.Start(); ; {
-		request, err := http.NewRequest("POST", destURL, bytes.NewReader(buf.Bytes()))
-		if err != nil {
-			return err
-		}
-		request = request.WithContext(ctx)
-		if customizeRequest != nil {
-			customizeRequest(request)
-		}
-		request.Header.Set("Content-Type", "text/xml; charset=utf-8")
-		request.Header.Set("SOAPAction", action)
-		request.Header.Set("Length", strconv.Itoa(buf.Len()))
+const (
+	// SOAP11 sends the SOAPAction header and text/xml.
+	SOAP11 = SOAPVersion(iota)
+	// SOAP12 sends application/soap+xml with the action parameter.
+	SOAP12
+)
 
-		if tryCount == 0 && logger.Enabled(ctx, slog.LevelDebug) {
-			logger.Debug("request", "header", request.Header, "body", buf.Bytes())
-		}
+// Client calls a SOAP endpoint.
+//
+// It is safe for concurrent use, and does not modify HTTPClient;
+// the fields must not be changed after the first call.
+type Client struct {
+	// HTTPClient is used for the calls, http.DefaultClient if nil.
+	// A copy of it is used, with its transport wrapped to accept compressed responses.
+	HTTPClient *http.Client
+	// Logger is slog.Default() if nil.
+	Logger *slog.Logger
+	// RetryStrategy of the failed requests, the package default if nil.
+	// The delays are jittered, unless the strategy is Regular.
+	RetryStrategy *retry.Strategy
+	// RetryClassifier decides whether the failed attempt is retried, DefaultRetryClassifier if nil.
+	RetryClassifier func(Attempt) bool
+	// Idempotent reports whether the action can be repeated safely.
+	// All actions are treated as non-idempotent if nil.
+	Idempotent func(action string) bool
+	// CircuitBreaker fails the calls fast while the endpoint is failing, if not nil.
+	CircuitBreaker *CircuitBreaker
+	// Cache of the responses, if not nil.
+	Cache *ResponseCache
+	// Metrics collects the metrics of the calls, ClientMetrics if nil.
+	Metrics *Metrics
+	// Redactor masks the sensitive data in the logs, ClientRedactor if nil.
+	Redactor *Redactor
+	// TracerProvider of the calls' spans, ClientTracerProvider if nil.
+	TracerProvider trace.TracerProvider
+	// Header is added to each request; its values are masked in the logs.
+	Header http.Header
+	// SOAPHeader returns the content of the soap:Header for the action.
+	SOAPHeader func(ctx context.Context, action string) (string, error)
+	// CustomizeRequest is called on each request, before sending it.
+	CustomizeRequest func(*http.Request)
+	// CustomizeResponse is called on the response, before reading it.
+	CustomizeResponse func(*http.Response)
+	// URL of the SOAP endpoint.
+	URL string
+	// Version of SOAP, SOAP11 by default.
+	Version SOAPVersion
 
-		tryCount++
-		start := time.Now()
-		response, err = client.Do(request)
-		dur = time.Since(start)
-		logger.Info("request",
-			slog.String("POST", request.URL.Redacted()),
-			slog.Any("header", request.Header),
-			slog.String("reqHead", reqHead), slog.String("reqTail", reqTail),
-			slog.Int("tryCount", tryCount), slog.String("dur", dur.String()),
-			slog.Any("error", err))
-		if err == nil {
-			break
+	once       sync.Once
+	httpClient *http.Client
+}
+
+// NewClient returns a Client for the SOAP endpoint at url.
+func NewClient(url string, logger *slog.Logger) *Client {
+	return &Client{URL: url, Logger: logger}
+}
+
+func (c *Client) init() {
+	c.once.Do(func() {
+		var hc http.Client
+		if c.HTTPClient != nil {
+			hc = *c.HTTPClient
 		}
-		if !iter.Next(ctx.Done()) {
-			return err
+		if hc.Transport == nil {
+			hc.Transport = http.DefaultTransport
 		}
+		hc.Transport = gzhttp.Transport(hc.Transport)
+		c.httpClient = &hc
+	})
+}
+
+func (c *Client) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.Default()
+	}
+	return c.Logger
+}
+
+func (c *Client) metrics() *Metrics {
+	if c.Metrics == nil {
+		return ClientMetrics
 	}
-	if customizeResponse != nil {
-		customizeResponse(response)
+	return c.Metrics
+}
+
+func (c *Client) redactor() *Redactor {
+	if c.Redactor == nil {
+		return ClientRedactor
 	}
-	defer response.Body.Close()
+	return c.Redactor
+}
 
-	buf.Reset()
-	if response.StatusCode >= 400 {
-		io.Copy(buf, response.Body)
-		logger.Error("response", "status", response.Status, "body", buf.String())
-		return fmt.Errorf("%s: %w", buf.String(), errors.New(response.Status))
+// redactHeader masks the sensitive headers of the request, and the values of c.Header.
+func (c *Client) redactHeader(redactor *Redactor, h http.Header) http.Header {
+	h = redactor.Header(h)
+	for k := range c.Header {
+		if k = http.CanonicalHeaderKey(k); len(h[k]) != 0 {
+			h[k] = []string{redacted}
+		}
 	}
+	return h
+}
 
-	sr, err := iohlp.MakeSectionReader(response.Body, 1<<20)
-	if err != nil {
-		logger.Error("read response", "error", err)
+// Call the endpoint with SOAPAction=action, decoding the response body's first element into resp.
+//
+// The SOAP faults (even in successful responses) are returned as *FaultError.
+func (c *Client) Call(ctx context.Context, action, reqBody string, resp any) (err error) {
+	ctx, call := c.startCall(ctx, action)
+	defer func() { call.end(err) }()
+	logger, redactor := c.logger(), c.redactor()
+	buf := bufPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		bufPool.Put(buf)
+	}()
+	var sr *io.SectionReader
+	statusCode, status := http.StatusOK, "cached"
+	if b, ok, err := c.cached(ctx, call, reqBody); err != nil {
 		return err
+	} else if ok {
+		sr = io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b)))
+	} else {
+		response, err := c.post(ctx, call, buf, reqBody)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		statusCode, status = response.StatusCode, response.Status
+		if sr, err = iohlp.MakeSectionReader(response.Body, 1<<20); err != nil {
+			logger.Error("read response", "error", err)
+			return err
+		}
 	}
 	dec := xml.NewDecoder(io.NewSectionReader(sr, 0, sr.Size()))
 	st, err := FindBody(dec)
@@ -143,48 +199,134 @@ func SOAPCallWithHeaderClient(ctx context.Context,
 		logger.Error("FindBody", "error", err)
 		return err
 	}
+	if isFault(st) {
+		fe, err := decodeFault(dec, st)
+		if err == nil {
+			fe.StatusCode = statusCode
+			err = fe
+		}
+		buf.Reset()
+		io.Copy(buf, io.NewSectionReader(sr, 0, sr.Size()))
+		logger.Error("response", "status", status, "body", redactor.XML(buf.String()), "error", err)
+		return err
+	}
 	err = dec.DecodeElement(resp, &st)
 	if !logger.Enabled(ctx, slog.LevelInfo) {
 		return err
 	}
+	buf.Reset()
 	if err != nil {
-		buf.Reset()
 		io.Copy(buf, sr)
-		logger.Error("response", buf.String(), "decoded", resp, "error", err)
+		logger.Error("response", "body", redactor.XML(buf.String()), "decoded", redactor.Value(resp), "error", err)
 		return err
 	}
 	respLen := sr.Size()
-	var respHead, respTail []byte
+	var respHead, respTail string
 	if logger.Enabled(ctx, slog.LevelDebug) {
-		respHead, _ = io.ReadAll(io.NewSectionReader(sr, 0, sr.Size()))
+		b, _ := io.ReadAll(io.NewSectionReader(sr, 0, sr.Size()))
+		respHead = redactor.XML(string(b))
 	} else {
+		// only the logged cuts are redacted, separately, as the element boundaries may fall into them
 		var respHeadA, respTailA [2048]byte
 		length, _ := sr.ReadAt(respHeadA[:], 0)
-		respHead = respHeadA[:length]
+		respHead = redactor.XML(string(respHeadA[:length]))
 		if rest := sr.Size() - int64(length); rest > 0 {
-			length, _ = sr.ReadAt(respTailA[:], sr.Size()-min(rest, int64(cap(respTail))))
-			respTail = respTailA[:length]
+			length, _ = sr.ReadAt(respTailA[:], sr.Size()-min(rest, int64(len(respTailA))))
+			respTail = redactor.XML(string(respTailA[:length]))
 		}
 	}
-	buf.Reset()
-	fmt.Fprintf(buf, "%#v", resp)
+	buf.WriteString(redactor.Value(resp))
 	decHead, decTail := splitHeadTail(buf.Bytes(), (buf.Len()+1)/2)
 	logger.Info("response",
 		slog.Group("resp",
 			slog.Int64("length", respLen),
-			slog.String("head", string(respHead)),
-			slog.String("tail", string(respTail)),
+			slog.String("head", respHead),
+			slog.String("tail", respTail),
 		),
 		slog.Group("decoded",
 			slog.Int("length", buf.Len()),
 			slog.String("head", decHead),
 			slog.String("tail", decTail),
 		),
-		slog.String("dur", dur.String()), slog.Int("tryCount", tryCount),
+		slog.String("dur", call.dur.String()), slog.Int("tryCount", call.tryCount),
 	)
 	return nil
 }
 
+// post the envelope of reqBody (built in buf), returning the successful response.
+// The response body must be closed by the caller.
+func (c *Client) post(ctx context.Context, call *clientCall, buf *bytes.Buffer, reqBody string) (*http.Response, error) {
+	c.init()
+	var soapHeader string
+	if c.SOAPHeader != nil {
+		var err error
+		if soapHeader, err = c.SOAPHeader(ctx, call.action); err != nil {
+			return nil, err
+		}
+	}
+	if c.Version == SOAP12 {
+		buf.WriteString(soap12Header)
+	} else {
+		buf.WriteString(SOAPHeader)
+	}
+	buf.WriteString(soapHeader)
+	buf.WriteString(SOAPBody)
+	buf.WriteString(reqBody)
+	buf.WriteString(SOAPFooter)
+	if err := call.do(ctx, c, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	response := call.response
+	if c.CustomizeResponse != nil {
+		c.CustomizeResponse(response)
+	}
+	if response.StatusCode < 400 {
+		return response, nil
+	}
+	defer response.Body.Close()
+	buf.Reset()
+	io.Copy(buf, response.Body)
+	c.logger().Error("response", "status", response.Status, "body", c.redactor().XML(buf.String()))
+	dec := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	if st, err := FindBody(dec); err == nil && isFault(st) {
+		if fe, err := decodeFault(dec, st); err == nil {
+			fe.StatusCode = response.StatusCode
+			return nil, fe
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", buf.String(), errors.New(response.Status))
+}
+
+// legacyClient returns the Client of the SOAPCall* functions' parameters.
+//
+// As these functions always retried the network errors, every action is Idempotent for it.
+func legacyClient(client *http.Client, destURL string,
+	customizeRequest func(*http.Request), customizeResponse func(*http.Response),
+	soapHeader string, logger *slog.Logger,
+) *Client {
+	c := Client{HTTPClient: client, URL: destURL, Logger: logger,
+		CustomizeRequest: customizeRequest, CustomizeResponse: customizeResponse,
+		CircuitBreaker: ClientCircuitBreaker, Cache: ClientCache,
+		Idempotent: func(string) bool { return true },
+	}
+	if soapHeader != "" {
+		c.SOAPHeader = func(context.Context, string) (string, error) { return soapHeader, nil }
+	}
+	return &c
+}
+
+// SOAPCallWithHeader calls with the given SOAP- and extra header and action.
+func SOAPCallWithHeaderClient(ctx context.Context,
+	client *http.Client,
+	destURL string,
+	customizeRequest func(req *http.Request), customizeResponse func(resp *http.Response),
+	action, soapHeader, reqBody string, resp any,
+	logger *slog.Logger,
+) error {
+	return legacyClient(client, destURL, customizeRequest, customizeResponse, soapHeader, logger).
+		Call(ctx, action, reqBody, resp)
+}
+
 // SOAPCallWithHeader calls with the given SOAP- and extra header and action.
 func SOAPCallWithHeader(ctx context.Context,
 	destURL string,
@@ -210,3 +352,151 @@ func splitHeadTail(b []byte, length int) (head string, tail string) {
 	}
 	return string(b[:length]), string(b[len(b)-length:])
 }
+
+// clientCall is the state of one call, shared by the tracing, metrics and logging.
+type clientCall struct {
+	start    time.Time
+	span     trace.Span
+	metrics  *Metrics
+	response *http.Response
+	action   string
+	dur      time.Duration
+	tryCount int
+}
+
+func (c *Client) startCall(ctx context.Context, action string) (context.Context, *clientCall) {
+	call := clientCall{action: action, start: time.Now(), metrics: c.metrics()}
+	ctx, call.span = c.tracer().Start(ctx, "SOAP "+action, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("soap.action", action)))
+	return ctx, &call
+}
+
+func (call *clientCall) end(err error) {
+	var statusCode int
+	if call.response != nil {
+		statusCode = call.response.StatusCode
+	}
+	call.metrics.observeClientCall(call.action, call.tryCount, time.Since(call.start), statusCode, err)
+	call.span.SetAttributes(attribute.Int("soap.try_count", call.tryCount))
+	endSpan(call.span, err)
+}
+
+// do POSTs the envelope to c.URL, retrying the attempts c.RetryClassifier allows, setting call.response.
+func (call *clientCall) do(ctx context.Context, c *Client, envelope []byte) error {
+	logger := c.logger()
+	retryStrategy := retryStrategy
+	if c.RetryStrategy != nil {
+		retryStrategy = *c.RetryStrategy
+	}
+	if s, ok := ctx.Value(retryStrategyKey{}).(retry.Strategy); ok {
+		retryStrategy = s
+	}
+	idempotent := c.Idempotent != nil && c.Idempotent(call.action)
+	if b, ok := ctx.Value(idempotentKey{}).(bool); ok {
+		idempotent = b
+	}
+	classify := c.RetryClassifier
+	if classify == nil {
+		classify = DefaultRetryClassifier
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		if d := time.Until(dl); d > time.Second {
+			retryStrategy.MaxDuration = d
+		}
+	}
+	tracer, redactor := c.tracer(), c.redactor()
+	reqHead, reqTail := splitHeadTail([]byte(redactor.XML(string(envelope))), 1024)
+	for iter := retryStrategy.Start(); ; {
+		request, err := http.NewRequest("POST", c.URL, bytes.NewReader(envelope))
+		if err != nil {
+			return err
+		}
+		actx, aSpan := tracer.Start(ctx, "attempt", trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.Int("soap.try", call.tryCount+1)))
+		request = request.WithContext(actx)
+		for k, vv := range c.Header {
+			request.Header[k] = append(request.Header[k], vv...)
+		}
+		if c.CustomizeRequest != nil {
+			c.CustomizeRequest(request)
+		}
+		if c.Version == SOAP12 {
+			request.Header.Set("Content-Type", `application/soap+xml; charset=utf-8; action="`+call.action+`"`)
+		} else {
+			request.Header.Set("Content-Type", "text/xml; charset=utf-8")
+			request.Header.Set("SOAPAction", call.action)
+		}
+		request.Header.Set("Length", strconv.Itoa(len(envelope)))
+		defaultPropagator.Inject(actx, propagation.HeaderCarrier(request.Header))
+
+		if call.tryCount == 0 && logger.Enabled(ctx, slog.LevelDebug) {
+			logger.Debug("request", "header", c.redactHeader(redactor, request.Header), "body", redactor.XML(string(envelope)))
+		}
+
+		var done func(context.Context, Attempt)
+		if c.CircuitBreaker != nil {
+			if done, err = c.CircuitBreaker.allow(c.URL, call.action); err != nil {
+				endSpan(aSpan, err)
+				logger.Warn("request", slog.String("POST", request.URL.Redacted()),
+					slog.Int("tryCount", call.tryCount), slog.Any("error", err))
+				return err
+			}
+		}
+		call.tryCount++
+		start := time.Now()
+		call.response, err = c.httpClient.Do(request)
+		call.dur = time.Since(start)
+		if call.response != nil {
+			aSpan.SetAttributes(attribute.Int("http.response.status_code", call.response.StatusCode))
+		}
+		endSpan(aSpan, err)
+		logger.Info("request",
+			slog.String("POST", request.URL.Redacted()),
+			slog.Any("header", c.redactHeader(redactor, request.Header)),
+			slog.String("reqHead", reqHead), slog.String("reqTail", reqTail),
+			slog.Int("tryCount", call.tryCount), slog.String("dur", call.dur.String()),
+			slog.Any("error", err))
+		attempt := Attempt{Err: err, Response: call.response, Action: call.action, Idempotent: idempotent}
+		if err == nil && call.response.StatusCode >= 400 {
+			// read the error response for its fault code, and give it back for the caller
+			b, _ := io.ReadAll(call.response.Body)
+			call.response.Body.Close()
+			call.response.Body = io.NopCloser(bytes.NewReader(b))
+			attempt.FaultCode = faultCode(b)
+		}
+		if done != nil {
+			done(ctx, attempt)
+		}
+		if err == nil && call.response.StatusCode < 400 {
+			return nil
+		}
+		if !classify(attempt) {
+			return err
+		}
+		next, ok := iter.NextTime()
+		if !ok {
+			return err
+		}
+		// Wait as the server asks, if it fits into the MaxDuration and the deadline,
+		// or just as the strategy says otherwise.
+		if d := retryAfter(call.response, time.Now()); d > 0 {
+			t := time.Now().Add(d)
+			dl, hasDeadline := ctx.Deadline()
+			if t.After(next) &&
+				(retryStrategy.MaxDuration == 0 || t.Sub(iter.StartTime()) <= retryStrategy.MaxDuration) &&
+				(!hasDeadline || t.Before(dl)) {
+				next = t
+			}
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		if call.response != nil {
+			call.response.Body.Close()
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/zlog/v2"
+	"github.com/rogpeppe/retry"
+)
+
+func TestClient(t *testing.T) {
+	var fail atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		var ns string
+		switch r.Header.Get("Content-Type") {
+		case "text/xml; charset=utf-8":
+			ns = soapEnvelopeURI
+			if r.Header.Get("SOAPAction") != "Act" {
+				t.Errorf("got SOAPAction %q", r.Header.Get("SOAPAction"))
+			}
+		case `application/soap+xml; charset=utf-8; action="Act"`:
+			ns = soap12EnvelopeURI
+		default:
+			t.Errorf("got Content-Type %q", r.Header.Get("Content-Type"))
+		}
+		if !strings.Contains(string(b), `xmlns:soapenv="`+ns+`"`) {
+			t.Errorf("got %s, wanted %q namespace", b, ns)
+		}
+		if !strings.Contains(string(b), "<soapenv:Header><auth/></soapenv:Header>") {
+			t.Errorf("got %s, wanted SOAP header", b)
+		}
+		if got := r.Header.Get("X-Test"); got != "1" {
+			t.Errorf("got X-Test=%q", got)
+		}
+		io.WriteString(w, `<?xml version="1.0" encoding="utf-8"?><soapenv:Envelope xmlns:soapenv="`+ns+`"><soapenv:Body><Resp><A>1</A></Resp>`+SOAPFooter)
+	}))
+	defer srv.Close()
+
+	hc := &http.Client{}
+	c := Client{
+		HTTPClient:    hc,
+		URL:           srv.URL,
+		Logger:        zlog.NewT(t).SLog(),
+		Header:        http.Header{"X-Test": {"1"}},
+		RetryStrategy: &retry.Strategy{Delay: time.Millisecond, MaxCount: 3},
+		SOAPHeader: func(ctx context.Context, action string) (string, error) {
+			return "<auth/>", nil
+		},
+	}
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			var resp struct{ A int }
+			if err := c.Call(ctx, "Act", "<Req/>", &resp); err != nil {
+				t.Error(err)
+			} else if resp.A != 1 {
+				t.Errorf("got %+v", resp)
+			}
+		})
+	}
+	wg.Wait()
+	if hc.Transport != nil {
+		t.Errorf("HTTPClient.Transport has been modified: %T", hc.Transport)
+	}
+
+	fail.Store(2)
+	c12 := Client{URL: srv.URL, Version: SOAP12, Header: c.Header, SOAPHeader: c.SOAPHeader,
+		RetryStrategy: c.RetryStrategy, Logger: c.Logger}
+	var resp struct{ A int }
+	if err := c12.Call(ctx, "Act", "<Req/>", &resp); err != nil {
+		t.Fatal(err)
+	} else if resp.A != 1 {
+		t.Errorf("got %+v", resp)
+	}
+
+	fail.Store(3)
+	if err := c12.Call(ctx, "Act", "<Req/>", &resp); err == nil {
+		t.Error("wanted error after 3 failed tries")
+	}
+}
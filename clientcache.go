@@ -0,0 +1,173 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ClientCache is the ResponseCache of the SOAPCall* functions, if not nil.
+var ClientCache *ResponseCache
+
+// ResponseCache caches the successful responses of the idempotent actions of a Client.
+//
+// The key of a response is the destination URL, the action and the canonicalized request body.
+// The SOAP header is not part of the key, so the cached actions must not depend on it
+// (e.g. on the caller's identity).
+//
+// The concurrent calls with the same key wait for the first one, instead of calling the server;
+// each of them can give up waiting by its own context, without canceling the others.
+type ResponseCache struct {
+	// Store of the responses, NewLRUStore(1024) if nil.
+	Store CacheStore
+	// TTL returns how long the response of the action is cached; the actions with zero TTL are not cached.
+	//
+	// The max-age of the response's Cache-Control header (or its Expires header) overrides it,
+	// and no-store or no-cache prevents caching the response.
+	TTL func(action string) time.Duration
+
+	group singleflight.Group
+	once  sync.Once
+}
+
+func (rc *ResponseCache) store() CacheStore {
+	rc.once.Do(func() {
+		if rc.Store == nil {
+			rc.Store = NewLRUStore(1024)
+		}
+	})
+	return rc.Store
+}
+
+// cached returns the response body from the cache, or calls the server and caches its response.
+// ok is false if the action is not cached.
+func (c *Client) cached(ctx context.Context, call *clientCall, reqBody string) (body []byte, ok bool, err error) {
+	rc := c.Cache
+	if rc == nil || rc.TTL == nil {
+		return nil, false, nil
+	}
+	ttl := rc.TTL(call.action)
+	if ttl <= 0 {
+		return nil, false, nil
+	}
+	key := cacheKey(c.URL, call.action, reqBody)
+	store := rc.store()
+	if b, ok := store.Get(key); ok {
+		c.metrics().observeClientCache(call.action, true)
+		c.logger().Debug("cache hit", "action", call.action, "key", key)
+		return b, true, nil
+	}
+	c.metrics().observeClientCache(call.action, false)
+	var fcall *clientCall
+	ch := rc.group.DoChan(key, func() (any, error) {
+		// the others wait for this call, too: it is not canceled with its first caller,
+		// but it is bounded by the first caller's deadline
+		fctx := context.WithoutCancel(ctx)
+		if dl, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			fctx, cancel = context.WithDeadline(fctx, dl)
+			defer cancel()
+		}
+		fcall = &clientCall{action: call.action, start: time.Now(), metrics: call.metrics}
+		buf := bufPool.Get().(*bytes.Buffer)
+		defer func() {
+			buf.Reset()
+			bufPool.Put(buf)
+		}()
+		response, err := c.post(fctx, fcall, buf, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		defer response.Body.Close()
+		b, err := io.ReadAll(response.Body)
+		if err != nil {
+			return nil, err
+		}
+		if expires, ok := responseExpiry(response.Header, time.Now(), ttl); ok && !hasFault(b) {
+			store.Set(key, b, expires)
+		}
+		return b, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, true, context.Cause(ctx)
+	case res := <-ch:
+		if fcall != nil {
+			call.response, call.tryCount, call.dur = fcall.response, fcall.tryCount, fcall.dur
+		}
+		if res.Err != nil {
+			return nil, true, res.Err
+		}
+		return res.Val.([]byte), true, nil
+	}
+}
+
+// cacheKey returns the hex-encoded hash of the destination, action and the canonicalized request.
+func cacheKey(destURL, action, reqBody string) string {
+	h := sha256.New()
+	io.WriteString(h, destURL)
+	h.Write([]byte{0})
+	io.WriteString(h, action)
+	h.Write([]byte{0})
+	if s, err := canonicalXML(reqBody); err == nil {
+		reqBody = s
+	}
+	io.WriteString(h, reqBody)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseExpiry returns when the response expires, by its cache headers, or ttl from now.
+// ok is false if the response must not be stored.
+func responseExpiry(h http.Header, now time.Time, ttl time.Duration) (expires time.Time, ok bool) {
+	for _, cc := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(cc, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			switch {
+			case directive == "no-store" || directive == "no-cache":
+				return expires, false
+			case strings.HasPrefix(directive, "max-age="):
+				n, err := strconv.Atoi(strings.Trim(directive[len("max-age="):], `"`))
+				if err != nil || n <= 0 {
+					return expires, false
+				}
+				return now.Add(time.Duration(n) * time.Second), true
+			}
+		}
+	}
+	if s := h.Get("Expires"); s != "" {
+		t, err := http.ParseTime(s)
+		return t, err == nil && t.After(now)
+	}
+	return now.Add(ttl), true
+}
+
+// hasFault reports whether the body of the envelope is a Fault.
+func hasFault(b []byte) bool {
+	st, err := FindBody(xml.NewDecoder(bytes.NewReader(b)))
+	return err == nil && isFault(st)
+}
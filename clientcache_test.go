@@ -0,0 +1,180 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+func TestResponseCache(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.Header.Get("SOAPAction") {
+		case "NoStore":
+			w.Header().Set("Cache-Control", "no-store")
+		case "Slow":
+			time.Sleep(50 * time.Millisecond)
+		case "Fault":
+			io.WriteString(w, SOAPHeader+SOAPBody+`<soapenv:Fault><faultcode>soapenv:Server</faultcode><faultstring>x</faultstring></soapenv:Fault>`+SOAPFooter)
+			return
+		}
+		io.WriteString(w, SOAPHeader+SOAPBody+`<Resp><A>1</A></Resp>`+SOAPFooter)
+	}))
+	defer srv.Close()
+
+	store := NewLRUStore(10)
+	c := Client{URL: srv.URL, Logger: zlog.NewT(t).SLog(),
+		Cache: &ResponseCache{Store: store, TTL: func(action string) time.Duration {
+			if action == "Uncached" {
+				return 0
+			}
+			return time.Hour
+		}},
+	}
+	ctx := context.Background()
+	for _, tC := range []struct {
+		action   string
+		wantHits int32
+		wantErr  bool
+	}{
+		{action: "Rates", wantHits: 1},
+		{action: "Uncached", wantHits: 3},
+		{action: "NoStore", wantHits: 3},
+		{action: "Fault", wantHits: 3, wantErr: true},
+	} {
+		hits.Store(0)
+		for _, req := range []string{`<Req a="1" b="2"><X>1</X></Req>`, "<Req b=\"2\" a=\"1\">\n  <X>1</X>\n</Req>", `<Req b="2" a="1"><X>1</X></Req>`} {
+			var resp struct{ A int }
+			if err := c.Call(ctx, tC.action, req, &resp); (err != nil) != tC.wantErr {
+				t.Errorf("%s: %+v", tC.action, err)
+			} else if err == nil && resp.A != 1 {
+				t.Errorf("%s: got %+v", tC.action, resp)
+			}
+		}
+		if got := hits.Load(); got != tC.wantHits {
+			t.Errorf("%s: got %d server hits, wanted %d", tC.action, got, tC.wantHits)
+		}
+	}
+
+	hits.Store(0)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			var resp struct{ A int }
+			if err := c.Call(ctx, "Slow", "<Req/>", &resp); err != nil || resp.A != 1 {
+				t.Errorf("got %+v, %+v", resp, err)
+			}
+		})
+	}
+	wg.Wait()
+	if got := hits.Load(); got != 1 {
+		t.Errorf("concurrent calls: got %d server hits, wanted 1", got)
+	}
+
+	// the first caller giving up does not cancel the call of the others
+	hits.Store(0)
+	c.Cache.Store = NewLRUStore(10)
+	ctx1, cancel := context.WithCancel(ctx)
+	errc := make(chan error, 1)
+	go func() {
+		var resp struct{ A int }
+		errc <- c.Call(ctx1, "Slow", "<Req/>", &resp)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	var resp struct{ A int }
+	done := make(chan error, 1)
+	go func() { done <- c.Call(ctx, "Slow", "<Req/>", &resp) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled caller: got %+v", err)
+	}
+	if err := <-done; err != nil || resp.A != 1 {
+		t.Errorf("waiting caller: got %+v, %+v", resp, err)
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("canceled first caller: got %d server hits, wanted 1", got)
+	}
+}
+
+func TestResponseExpiry(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	for _, tC := range []struct {
+		header http.Header
+		want   time.Time
+		wantOK bool
+	}{
+		{header: http.Header{}, want: now.Add(time.Hour), wantOK: true},
+		{header: http.Header{"Cache-Control": {"public, max-age=60"}}, want: now.Add(time.Minute), wantOK: true},
+		{header: http.Header{"Cache-Control": {"max-age=0"}}},
+		{header: http.Header{"Cache-Control": {"No-Cache"}}},
+		{header: http.Header{"Expires": {now.Add(2 * time.Hour).Format(http.TimeFormat)}}, want: now.Add(2 * time.Hour), wantOK: true},
+		{header: http.Header{"Expires": {"0"}}},
+	} {
+		got, ok := responseExpiry(tC.header, now, time.Hour)
+		if ok != tC.wantOK || ok && !got.Equal(tC.want) {
+			t.Errorf("%v: got %v, %t, wanted %v, %t", tC.header, got, ok, tC.want, tC.wantOK)
+		}
+	}
+}
+
+func TestCacheStores(t *testing.T) {
+	disk, err := NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lru := NewLRUStore(3)
+	for name, store := range map[string]CacheStore{"lru": lru, "disk": disk} {
+		expires := time.Now().Add(time.Hour)
+		store.Set("a", []byte("A"), expires)
+		store.Set("b", []byte("B"), expires)
+		store.Set("x", []byte("X"), time.Now().Add(-time.Second))
+		if _, ok := store.Get("x"); ok {
+			t.Errorf("%s: got expired entry", name)
+		}
+		for _, k := range []string{"a", "b"} {
+			if b, ok := store.Get(k); !ok || string(b) != strings.ToUpper(k) {
+				t.Errorf("%s: %s: got %q, %t", name, k, b, ok)
+			}
+		}
+	}
+	// "a" is the least recently used
+	lru.Set("c", []byte("C"), time.Now().Add(time.Hour))
+	lru.Set("d", []byte("D"), time.Now().Add(time.Hour))
+	if _, ok := lru.Get("a"); ok || lru.Len() != 3 {
+		t.Errorf("lru: got a after eviction (len=%d)", lru.Len())
+	}
+
+	disk.Set("y", []byte("Y"), time.Now().Add(-time.Second))
+	if err = disk.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := disk.Get("a"); !ok {
+		t.Error("disk: purged a")
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+)
+
+// SOAPCallStreamClient calls like SOAPCallWithHeaderClient, but calls each for the elements
+// named elementName of the response, as Client.CallStream.
+func SOAPCallStreamClient(ctx context.Context,
+	client *http.Client,
+	destURL string,
+	customizeRequest func(req *http.Request), customizeResponse func(resp *http.Response),
+	action, soapHeader, reqBody string,
+	elementName string, each func(dec *xml.Decoder, st xml.StartElement) error,
+	logger *slog.Logger,
+) error {
+	return legacyClient(client, destURL, customizeRequest, customizeResponse, soapHeader, logger).
+		CallStream(ctx, action, reqBody, elementName, each)
+}
+
+// SOAPCallSeq calls like SOAPCallStreamClient, yielding the decoded elements as CallSeq.
+func SOAPCallSeq[T any](ctx context.Context,
+	client *http.Client,
+	destURL string,
+	customizeRequest func(req *http.Request), customizeResponse func(resp *http.Response),
+	action, soapHeader, reqBody string,
+	elementName string,
+	logger *slog.Logger,
+) iter.Seq2[*T, error] {
+	return CallSeq[T](ctx,
+		legacyClient(client, destURL, customizeRequest, customizeResponse, soapHeader, logger),
+		action, reqBody, elementName)
+}
+
+// ErrStopStream is returned (maybe wrapped) by the each func of CallStream to stop reading the response, without an error.
+var ErrStopStream = errors.New("stop the stream")
+
+// CallStream calls like Call, but instead of decoding the whole response body,
+// calls each for every element named elementName (by local name, at any depth)
+// in the SOAP Body, as it arrives - the memory used is bounded by the element, not the response.
+//
+// each is called with the decoder positioned right after the start element,
+// and must consume the element, till its end (e.g. by dec.DecodeElement(&v, &st) or dec.Skip()).
+// The error returned by each stops the processing and is returned as is, except ErrStopStream,
+// which stops it as a success.
+func (c *Client) CallStream(ctx context.Context,
+	action, reqBody string,
+	elementName string, each func(dec *xml.Decoder, st xml.StartElement) error,
+) (err error) {
+	ctx, call := c.startCall(ctx, action)
+	defer func() { call.end(err) }()
+	logger := c.logger()
+	buf := bufPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		bufPool.Put(buf)
+	}()
+	response, err := c.post(ctx, call, buf, reqBody)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	ht := headTail{max: 2048}
+	dec := xml.NewDecoder(bufio.NewReader(io.TeeReader(response.Body, &ht)))
+	var count int
+	err = func() error {
+		st, err := FindBody(dec)
+		if err != nil {
+			return fmt.Errorf("FindBody: %w", err)
+		}
+		if isFault(st) {
+			fe, err := decodeFault(dec, st)
+			if err == nil {
+				fe.StatusCode = response.StatusCode
+				err = fe
+			}
+			return err
+		}
+		// the depth in the Body
+		depth := 2
+		if st.Name.Local == elementName {
+			count++
+			if err = each(dec, st); err != nil {
+				return err
+			}
+			depth = 1
+		}
+		for depth > 0 {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			switch x := tok.(type) {
+			case xml.StartElement:
+				if x.Name.Local != elementName {
+					depth++
+					continue
+				}
+				count++
+				if err = each(dec, x); err != nil {
+					return err
+				}
+			case xml.EndElement:
+				depth--
+			}
+		}
+		return nil
+	}()
+	stopped := errors.Is(err, ErrStopStream)
+	if stopped {
+		err = nil
+	}
+	// the cuts of the head and tail are redacted separately, the element boundaries may fall into them
+	respHead, respTail := c.redactor().XML(string(ht.head)), c.redactor().XML(string(ht.tail))
+	if err != nil {
+		logger.Error("response",
+			slog.Group("resp",
+				slog.Int64("length", ht.n),
+				slog.String("head", respHead),
+				slog.String("tail", respTail),
+			),
+			slog.Int("elements", count), slog.Any("error", err))
+		return err
+	}
+	logger.Info("response",
+		slog.Group("resp",
+			slog.Int64("length", ht.n),
+			slog.String("head", respHead),
+			slog.String("tail", respTail),
+		),
+		slog.Int("elements", count), slog.Bool("stopped", stopped),
+		slog.String("dur", call.dur.String()), slog.Int("tryCount", call.tryCount),
+	)
+	return nil
+}
+
+// CallSeq calls c like CallStream, yielding the elements named elementName,
+// decoded into T, one by one.
+//
+// The call is made when the iteration starts; breaking out of the loop stops reading the response.
+// The error of the call is yielded last, with a nil element.
+func CallSeq[T any](ctx context.Context, c *Client, action, reqBody, elementName string) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		err := c.CallStream(ctx, action, reqBody, elementName,
+			func(dec *xml.Decoder, st xml.StartElement) error {
+				var v T
+				if err := dec.DecodeElement(&v, &st); err != nil {
+					return err
+				}
+				if !yield(&v, nil) {
+					return ErrStopStream
+				}
+				return nil
+			})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// headTail keeps the first and the last max bytes written into it.
+type headTail struct {
+	head, tail []byte
+	n          int64
+	max        int
+}
+
+func (ht *headTail) Write(p []byte) (int, error) {
+	length := len(p)
+	ht.n += int64(length)
+	if n := min(ht.max-len(ht.head), len(p)); n > 0 {
+		ht.head = append(ht.head, p[:n]...)
+		p = p[n:]
+	}
+	if len(p) == 0 {
+		return length, nil
+	}
+	if len(p) >= ht.max {
+		ht.tail = append(ht.tail[:0], p[len(p)-ht.max:]...)
+	} else {
+		if over := len(ht.tail) + len(p) - ht.max; over > 0 {
+			ht.tail = append(ht.tail[:0], ht.tail[over:]...)
+		}
+		ht.tail = append(ht.tail, p...)
+	}
+	return length, nil
+}
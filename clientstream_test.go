@@ -0,0 +1,121 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/UNO-SOFT/zlog/v2"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestSOAPCallStream(t *testing.T) {
+	const n = 10000
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, SOAPHeader+SOAPBody+`<Resp><Count>`+fmt.Sprint(n)+`</Count><Rows>`)
+		for i := range n {
+			fmt.Fprintf(w, "<Row><ID>%d</ID><Name>n%d</Name></Row>\n", i, i)
+		}
+		io.WriteString(w, `</Rows></Resp>`+SOAPFooter)
+	}))
+	defer srv.Close()
+	logger := zlog.NewT(t).SLog()
+	ctx := context.Background()
+
+	type row struct {
+		ID   int
+		Name string
+	}
+	var i int
+	if err := SOAPCallStreamClient(ctx, nil, srv.URL, nil, nil, "Act", "", "<Req/>",
+		"Row", func(dec *xml.Decoder, st xml.StartElement) error {
+			var r row
+			if err := dec.DecodeElement(&r, &st); err != nil {
+				return err
+			}
+			if r.ID != i || r.Name != fmt.Sprintf("n%d", i) {
+				return fmt.Errorf("%d. got %+v", i, r)
+			}
+			i++
+			return nil
+		}, logger,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if i != n {
+		t.Errorf("got %d rows, wanted %d", i, n)
+	}
+
+	i = 0
+	for r, err := range SOAPCallSeq[row](ctx, nil, srv.URL, nil, nil, "Act", "", "<Req/>", "Row", logger) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.ID != i {
+			t.Errorf("%d. got %+v", i, r)
+		}
+		if i++; i == 10 {
+			break
+		}
+	}
+	if i != 10 {
+		t.Errorf("got %d rows, wanted 10", i)
+	}
+
+	// breaking out of the loop is not a failed call
+	tp, exp := newTestTracerProvider()
+	c := Client{URL: srv.URL, Logger: logger, TracerProvider: tp}
+	for range CallSeq[row](ctx, &c, "Act", "<Req/>", "Row") {
+		break
+	}
+	spans := exp.GetSpans()
+	if len(spans) == 0 {
+		t.Error("no spans")
+	}
+	for _, s := range spans {
+		if s.Status.Code == codes.Error {
+			t.Errorf("%s: got status %+v", s.Name, s.Status)
+		}
+	}
+}
+
+func TestHeadTail(t *testing.T) {
+	var b bytes.Buffer
+	for i := range 1000 {
+		fmt.Fprintf(&b, "%03d,", i)
+	}
+	want := b.Bytes()
+	for _, chunk := range []int{1, 3, 7, 100, 5000} {
+		ht := headTail{max: 16}
+		for p := want; len(p) != 0; {
+			k := min(chunk, len(p))
+			if n, err := ht.Write(p[:k]); n != k || err != nil {
+				t.Fatalf("Write: %d, %+v", n, err)
+			}
+			p = p[k:]
+		}
+		if ht.n != int64(len(want)) || !bytes.Equal(ht.head, want[:16]) || !bytes.Equal(ht.tail, want[len(want)-16:]) {
+			t.Errorf("%d: got %d %q %q", chunk, ht.n, ht.head, ht.tail)
+		}
+	}
+}
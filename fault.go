@@ -0,0 +1,163 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// FaultError is a SOAP (1.1 or 1.2) fault returned by the server, as the error of the Client's calls.
+//
+// It is returned for the faults in successful (200) responses, too.
+type FaultError struct {
+	SOAPFault
+	// DetailName is the name of the first element of the detail.
+	DetailName xml.Name
+	// DetailXML is the inner XML of the detail, with the namespaces declared.
+	DetailXML []byte
+	// StatusCode is the HTTP status of the response.
+	StatusCode int
+
+	detail []xml.Token
+}
+
+func (e *FaultError) Error() string { return e.Code + ": " + e.String }
+
+// FaultCode returns the faultcode, such as "soapenv:Client".
+func (e *FaultError) FaultCode() string { return e.Code }
+
+// FaultString returns the faultstring.
+func (e *FaultError) FaultString() string { return e.String }
+
+// DecodeDetail decodes the first element of the detail into v.
+//
+// Returns io.EOF if the detail is empty.
+func (e *FaultError) DecodeDetail(v any) error {
+	if e.DetailName.Local == "" {
+		return io.EOF
+	}
+	return xml.NewTokenDecoder(&tokenSlice{tokens: e.detail}).Decode(v)
+}
+
+type tokenSlice struct{ tokens []xml.Token }
+
+func (ts *tokenSlice) Token() (xml.Token, error) {
+	if len(ts.tokens) == 0 {
+		return nil, io.EOF
+	}
+	tok := ts.tokens[0]
+	ts.tokens = ts.tokens[1:]
+	return tok, nil
+}
+
+// isFault reports whether the element is a soap:Fault.
+func isFault(st xml.StartElement) bool {
+	if st.Name.Local != "Fault" {
+		return false
+	}
+	switch st.Name.Space {
+	case soapEnvelopeURI, soap12EnvelopeURI, "", prefix, "SOAP-ENV":
+		return true
+	}
+	return false
+}
+
+// decodeFault decodes the Fault element, both SOAP 1.1 and 1.2 forms.
+func decodeFault(dec *xml.Decoder, st xml.StartElement) (*FaultError, error) {
+	var f struct {
+		// SOAP 1.1
+		Code   string       `xml:"faultcode"`
+		String string       `xml:"faultstring"`
+		Actor  string       `xml:"faultactor"`
+		Detail *faultDetail `xml:"detail"`
+		// SOAP 1.2
+		Code12   string       `xml:"Code>Value"`
+		Reason12 []string     `xml:"Reason>Text"`
+		Role12   string       `xml:"Role"`
+		Detail12 *faultDetail `xml:"Detail"`
+	}
+	if err := dec.DecodeElement(&f, &st); err != nil {
+		return nil, err
+	}
+	if f.Code == "" {
+		f.Code, f.Actor, f.Detail = f.Code12, f.Role12, f.Detail12
+		if len(f.Reason12) != 0 {
+			f.String = f.Reason12[0]
+		}
+	}
+	fe := FaultError{SOAPFault: SOAPFault{
+		XMLName: st.Name,
+		Code:    strings.TrimSpace(f.Code),
+		String:  strings.TrimSpace(f.String),
+		Actor:   strings.TrimSpace(f.Actor),
+	}}
+	if f.Detail == nil {
+		return &fe, nil
+	}
+	fe.Detail = strings.TrimSpace(f.Detail.exception.String())
+	fe.detail = f.Detail.tokens
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	for _, tok := range fe.detail {
+		if st, ok := tok.(xml.StartElement); ok && fe.DetailName.Local == "" {
+			fe.DetailName = st.Name
+		}
+		if err := enc.EncodeToken(tok); err != nil {
+			return &fe, err
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return &fe, err
+	}
+	fe.DetailXML = bytes.TrimSpace(buf.Bytes())
+	return &fe, nil
+}
+
+// faultDetail collects the tokens of the detail, with the namespaces resolved.
+type faultDetail struct {
+	exception strings.Builder
+	tokens    []xml.Token
+}
+
+func (d *faultDetail) UnmarshalXML(dec *xml.Decoder, st xml.StartElement) error {
+	var depth int
+	var inException bool
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch x := tok.(type) {
+		case xml.StartElement:
+			depth++
+			inException = depth == 1 && x.Name.Local == "ExceptionDetail"
+		case xml.EndElement:
+			if depth == 0 {
+				return nil
+			}
+			depth--
+			inException = inException && depth != 0
+		case xml.CharData:
+			if inException {
+				d.exception.Write(x)
+			}
+		}
+		d.tokens = append(d.tokens, xml.CopyToken(tok))
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+func TestFaultError(t *testing.T) {
+	const (
+		fault11 = `<?xml version="1.0"?><soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:e="urn:errors"><soapenv:Body>
+<soapenv:Fault><faultcode>soapenv:Client</faultcode><faultstring>no such email</faultstring><faultactor>urn:db</faultactor>
+<detail><e:NotFound><e:Key>a@b</e:Key></e:NotFound></detail></soapenv:Fault></soapenv:Body></soapenv:Envelope>`
+		fault12 = `<?xml version="1.0"?><env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body>
+<env:Fault><env:Code><env:Value>env:Receiver</env:Value></env:Code><env:Reason><env:Text xml:lang="en">busy</env:Text></env:Reason>
+<env:Detail><ExceptionDetail>stack</ExceptionDetail></env:Detail></env:Fault></env:Body></env:Envelope>`
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("SOAPAction") == "1.1" {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, fault11)
+			return
+		}
+		io.WriteString(w, fault12)
+	}))
+	defer srv.Close()
+	c := Client{URL: srv.URL, Logger: zlog.NewT(t).SLog()}
+	ctx := context.Background()
+
+	var resp struct{ A int }
+	err := c.Call(ctx, "1.1", "<Req/>", &resp)
+	var fe *FaultError
+	if !errors.As(err, &fe) {
+		t.Fatalf("got %#v, wanted FaultError", err)
+	}
+	if fe.Code != "soapenv:Client" || fe.String != "no such email" || fe.Actor != "urn:db" || fe.StatusCode != 500 {
+		t.Errorf("got %+v", fe)
+	}
+	if want := (xml.Name{Space: "urn:errors", Local: "NotFound"}); fe.DetailName != want {
+		t.Errorf("got detail %v, wanted %v", fe.DetailName, want)
+	}
+	var detail struct {
+		XMLName xml.Name `xml:"urn:errors NotFound"`
+		Key     string   `xml:"urn:errors Key"`
+	}
+	if err = fe.DecodeDetail(&detail); err != nil {
+		t.Fatal(err)
+	}
+	if detail.Key != "a@b" {
+		t.Errorf("got %+v", detail)
+	}
+	if !strings.Contains(string(fe.DetailXML), `xmlns="urn:errors"`) {
+		t.Errorf("got detail XML %s", fe.DetailXML)
+	}
+
+	for name, call := range map[string]func() error{
+		"Call": func() error { return c.Call(ctx, "1.2", "<Req/>", &resp) },
+		"CallStream": func() error {
+			return c.CallStream(ctx, "1.2", "<Req/>", "Row", func(dec *xml.Decoder, st xml.StartElement) error {
+				t.Error("no Row is expected")
+				return dec.Skip()
+			})
+		},
+	} {
+		fe = nil
+		if err = call(); !errors.As(err, &fe) {
+			t.Fatalf("%s: got %#v, wanted FaultError", name, err)
+		}
+		if fe.Code != "env:Receiver" || fe.String != "busy" || fe.Detail != "stack" || fe.StatusCode != 200 {
+			t.Errorf("%s: got %+v", name, fe)
+		}
+	}
+}
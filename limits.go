@@ -0,0 +1,145 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrLimitExceeded is returned (wrapped) when the request exceeds any of the XMLLimits.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// XMLLimits limits the size and complexity of the incoming requests.
+// Zero values mean no limit.
+//
+// The limits are checked while the tokens are read, so a huge or deeply nested
+// request is rejected without reading it whole.
+// (encoding/xml does not expand user-defined entities, so there's no "billion laughs" expansion.)
+type XMLLimits struct {
+	// MaxBodySize is the maximum size of the request body, in bytes.
+	MaxBodySize int64 `json:"maxBodySize,omitempty"`
+	// MaxDepth is the maximum nesting depth of the elements.
+	MaxDepth int `json:"maxDepth,omitempty"`
+	// MaxElements is the maximum number of elements.
+	MaxElements int `json:"maxElements,omitempty"`
+	// MaxAttributes is the maximum number of attributes of one element.
+	MaxAttributes int `json:"maxAttributes,omitempty"`
+	// MaxTextLength is the maximum length of a text node, comment or attribute value, in bytes.
+	MaxTextLength int `json:"maxTextLength,omitempty"`
+}
+
+func (limits XMLLimits) isZero() bool { return limits == XMLLimits{} }
+
+// limitBody limits the size of the request body to MaxBodySize.
+func (limits XMLLimits) limitBody(w http.ResponseWriter, r *http.Request) {
+	if limits.MaxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limits.MaxBodySize)
+	}
+}
+
+// newDecoder returns an xml.Decoder enforcing the limits,
+// and a function returning the input offset of the underlying byte stream.
+func (limits XMLLimits) newDecoder(r io.Reader) (*xml.Decoder, func() int64) {
+	raw := newXMLDecoder(r)
+	if limits.isZero() {
+		return raw, raw.InputOffset
+	}
+	dec := xml.NewTokenDecoder(&limitedTokenReader{dec: raw, XMLLimits: limits})
+	return dec, raw.InputOffset
+}
+
+// limitedTokenReader checks the limits on each raw token.
+// The wrapping xml.Decoder does the namespace translation and the element matching.
+type limitedTokenReader struct {
+	dec             *xml.Decoder
+	depth, elements int
+	XMLLimits
+}
+
+func (lr *limitedTokenReader) Token() (xml.Token, error) {
+	tok, err := lr.dec.RawToken()
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return tok, newLimitError(http.StatusRequestEntityTooLarge, "body size", mbe.Limit)
+		}
+		return tok, err
+	}
+	switch x := tok.(type) {
+	case xml.StartElement:
+		lr.depth++
+		lr.elements++
+		if lr.MaxDepth > 0 && lr.depth > lr.MaxDepth {
+			return nil, newLimitError(http.StatusBadRequest, "element depth", int64(lr.MaxDepth))
+		}
+		if lr.MaxElements > 0 && lr.elements > lr.MaxElements {
+			return nil, newLimitError(http.StatusBadRequest, "element count", int64(lr.MaxElements))
+		}
+		if lr.MaxAttributes > 0 && len(x.Attr) > lr.MaxAttributes {
+			return nil, newLimitError(http.StatusBadRequest, "attribute count", int64(lr.MaxAttributes))
+		}
+		if lr.MaxTextLength > 0 {
+			for _, a := range x.Attr {
+				if len(a.Value) > lr.MaxTextLength {
+					return nil, newLimitError(http.StatusBadRequest, "attribute length", int64(lr.MaxTextLength))
+				}
+			}
+		}
+	case xml.EndElement:
+		lr.depth--
+	case xml.CharData:
+		if lr.MaxTextLength > 0 && len(x) > lr.MaxTextLength {
+			return nil, newLimitError(http.StatusBadRequest, "text length", int64(lr.MaxTextLength))
+		}
+	case xml.Comment:
+		if lr.MaxTextLength > 0 && len(x) > lr.MaxTextLength {
+			return nil, newLimitError(http.StatusBadRequest, "comment length", int64(lr.MaxTextLength))
+		}
+	case xml.Directive:
+		if lr.MaxTextLength > 0 && len(x) > lr.MaxTextLength {
+			return nil, newLimitError(http.StatusBadRequest, "directive length", int64(lr.MaxTextLength))
+		}
+	}
+	return tok, nil
+}
+
+// limitError is mapped to 413 (body size) or 400 and soapenv:Client fault.
+type limitError struct {
+	error
+	code int
+}
+
+func newLimitError(code int, what string, limit int64) *limitError {
+	return &limitError{code: code, error: fmt.Errorf("%s exceeds %d: %w", what, limit, ErrLimitExceeded)}
+}
+
+func (e *limitError) Unwrap() error       { return e.error }
+func (e *limitError) Code() int           { return e.code }
+func (e *limitError) FaultCode() string   { return prefix + ":Client" }
+func (e *limitError) FaultString() string { return e.Error() }
+
+// asLimitError converts a *http.MaxBytesError into a limitError.
+func asLimitError(err error) error {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return fmt.Errorf("%w: %w", newLimitError(http.StatusRequestEntityTooLarge, "body size", mbe.Limit), err)
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+func TestXMLLimits(t *testing.T) {
+	deep := strings.Replace(loginRequest, "<PLoginNev>b0917174</PLoginNev>",
+		strings.Repeat("<a>", 50)+strings.Repeat("</a>", 50)+"<PLoginNev>b0917174</PLoginNev>", 1)
+	long := strings.Replace(loginRequest, "b0917174", strings.Repeat("x", 1000), 1)
+	for nm, tc := range map[string]struct {
+		Body   string
+		Limits XMLLimits
+		Code   int
+	}{
+		"ok":          {loginRequest, XMLLimits{MaxBodySize: 1 << 20, MaxDepth: 10, MaxElements: 100, MaxTextLength: 100, MaxAttributes: 10}, http.StatusOK},
+		"bodySize":    {loginRequest, XMLLimits{MaxBodySize: 100}, http.StatusRequestEntityTooLarge},
+		"depth":       {deep, XMLLimits{MaxDepth: 10}, http.StatusBadRequest},
+		"elements":    {loginRequest, XMLLimits{MaxElements: 10}, http.StatusBadRequest},
+		"textLength":  {long, XMLLimits{MaxTextLength: 100}, http.StatusBadRequest},
+		"attributes":  {loginRequest, XMLLimits{MaxAttributes: 2}, http.StatusBadRequest},
+		"keepEmpty":   {deep, XMLLimits{MaxDepth: 10}, http.StatusBadRequest},
+		"keepEmptyOK": {long, XMLLimits{MaxElements: 100}, http.StatusOK},
+	} {
+		h := NewSOAPHandler(SOAPHandlerConfig{Client: &stubClient{}, Logger: zlog.NewT(t).SLog(), Limits: tc.Limits})
+		req := httptest.NewRequest("POST", "/", strings.NewReader(tc.Body))
+		req.Header.Set("SOAPAction", "Login")
+		if strings.HasPrefix(nm, "keepEmpty") {
+			req.Header.Set("Keep-Empty-Tags", "1")
+		}
+		rec := httptest.NewRecorder()
+		h.serveHTTP(rec, req)
+		if rec.Code != tc.Code {
+			t.Errorf("%s: got %d, wanted %d: %s", nm, rec.Code, tc.Code, rec.Body.String())
+			continue
+		}
+		if tc.Code != http.StatusOK && !strings.Contains(rec.Body.String(), "<faultcode>soapenv:Client</faultcode>") {
+			t.Errorf("%s: no Client fault: %s", nm, rec.Body.String())
+		}
+	}
+}
+
+func TestXMLLimitsRaw(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("testdata", "withAny.wsdl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewSOAPHandler(SOAPHandlerConfig{
+		Client: &stubClient{Inputs: map[string]func() any{
+			"DbWebGdpr_Keres": func() any { return &struct{ PRawXml string }{} },
+		}}, Logger: zlog.NewT(t).SLog(), WSDL: string(b),
+		Limits: XMLLimits{MaxDepth: 10, MaxElements: 100},
+	})
+	req := httptest.NewRequest("POST", "/", strings.NewReader(xml.Header+`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>
+<DbWebGdpr_Keres_Input><GDPRRequest><ID>1</ID></GDPRRequest></DbWebGdpr_Keres_Input></soap:Body></soap:Envelope>`))
+	req.Header.Set("SOAPAction", "http://unosoft.hu/ws/bruno/pb/gdpr/gdpr.proto/Gdpr/DbWebGdpr_Keres")
+	_, inp, err := h.DecodeRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := inp.(*struct{ PRawXml string }).PRawXml, "<GDPRRequest><ID>1</ID></GDPRRequest>"; got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"google.golang.org/grpc/status"
+)
+
+// ClientMetrics collects the metrics of the SOAPCall* functions,
+// and of the Clients and CircuitBreakers without Metrics, if not nil.
+var ClientMetrics *Metrics
+
+// sizeBuckets are the histogram buckets for the request and response sizes: 256B - 64MiB.
+var sizeBuckets = metrics.ExponentialBuckets(256, 4, 10)
+
+// Metrics collects the metrics of the proxied calls, in Prometheus exposition format.
+//
+// The exposed metrics are
+//
+//	soapproxy_requests_total{operation}
+//	soapproxy_faults_total{operation,faultcode,grpc_code}
+//	soapproxy_request_duration_seconds{operation,phase="decode|call|encode"}
+//	soapproxy_request_size_bytes{operation}
+//	soapproxy_response_size_bytes{operation}
+//	soapproxy_response_parts_total{operation}
+//	soapproxy_merged_fields_total{operation}
+//	soapproxy_cache_requests_total{operation,result="hit|miss"}
+//	soapproxy_client_aborts_total{operation}
+//
+// and for the client side
+//
+//	soapproxy_client_requests_total{action,status}
+//	soapproxy_client_retries_total{action}
+//	soapproxy_client_request_duration_seconds{action}
+//	soapproxy_client_circuit_state_changes_total{circuit,state}
+//	soapproxy_client_circuit_rejected_total{circuit}
+//	soapproxy_client_cache_requests_total{action,result="hit|miss"}
+//
+// A nil *Metrics collects nothing.
+type Metrics struct {
+	set *metrics.Set
+}
+
+// NewMetrics returns a new, empty Metrics.
+func NewMetrics() *Metrics { return &Metrics{set: metrics.NewSet()} }
+
+// Set returns the underlying metrics.Set, for registering it with metrics.RegisterSet.
+func (m *Metrics) Set() *metrics.Set { return m.set }
+
+// WritePrometheus writes the metrics in Prometheus text exposition format.
+func (m *Metrics) WritePrometheus(w io.Writer) { m.set.WritePrometheus(w) }
+
+// ServeHTTP serves the metrics, to be used as the /metrics handler.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.set.WritePrometheus(w)
+}
+
+// requestStats are the statistics of one proxied request.
+type requestStats struct {
+	Operation              string
+	Decode, Call, Encode   time.Duration
+	RequestBytes           int64
+	Parts, MergedFields    int
+	decoded, called, ended bool
+	// Aborted is set when the client has gone before the response was written.
+	Aborted bool
+}
+
+func (m *Metrics) observeRequest(st requestStats, rec *responseRecorder) {
+	if m == nil {
+		return
+	}
+	op := st.Operation
+	m.set.GetOrCreateCounter(metricName("soapproxy_requests_total", "operation", op)).Inc()
+	if rec.fault != nil {
+		m.set.GetOrCreateCounter(metricName("soapproxy_faults_total",
+			"operation", op, "faultcode", rec.fault.Code,
+			"grpc_code", status.Code(rec.faultErr).String(),
+		)).Inc()
+	}
+	if st.decoded {
+		m.set.GetOrCreatePrometheusHistogram(metricName("soapproxy_request_duration_seconds", "operation", op, "phase", "decode")).Update(st.Decode.Seconds())
+	}
+	if st.called {
+		m.set.GetOrCreatePrometheusHistogram(metricName("soapproxy_request_duration_seconds", "operation", op, "phase", "call")).Update(st.Call.Seconds())
+	}
+	if st.ended {
+		m.set.GetOrCreatePrometheusHistogram(metricName("soapproxy_request_duration_seconds", "operation", op, "phase", "encode")).Update(st.Encode.Seconds())
+	}
+	m.set.GetOrCreatePrometheusHistogramExt(metricName("soapproxy_request_size_bytes", "operation", op), sizeBuckets).Update(float64(st.RequestBytes))
+	m.set.GetOrCreatePrometheusHistogramExt(metricName("soapproxy_response_size_bytes", "operation", op), sizeBuckets).Update(float64(rec.written))
+	if st.Parts != 0 {
+		m.set.GetOrCreateCounter(metricName("soapproxy_response_parts_total", "operation", op)).Add(st.Parts)
+	}
+	if st.MergedFields != 0 {
+		m.set.GetOrCreateCounter(metricName("soapproxy_merged_fields_total", "operation", op)).Add(st.MergedFields)
+	}
+	if st.Aborted {
+		m.set.GetOrCreateCounter(metricName("soapproxy_client_aborts_total", "operation", op)).Inc()
+	}
+}
+
+func (m *Metrics) observeClientCall(action string, tryCount int, dur time.Duration, statusCode int, err error) {
+	if m == nil {
+		return
+	}
+	st := "error"
+	if statusCode != 0 {
+		st = strconv.Itoa(statusCode)
+	} else if err == nil {
+		st = "ok"
+	}
+	m.set.GetOrCreateCounter(metricName("soapproxy_client_requests_total", "action", action, "status", st)).Inc()
+	if tryCount > 1 {
+		m.set.GetOrCreateCounter(metricName("soapproxy_client_retries_total", "action", action)).Add(tryCount - 1)
+	}
+	m.set.GetOrCreatePrometheusHistogram(metricName("soapproxy_client_request_duration_seconds", "action", action)).Update(dur.Seconds())
+}
+
+func (m *Metrics) observeCircuit(key string, state CircuitState) {
+	if m == nil {
+		return
+	}
+	m.set.GetOrCreateCounter(metricName("soapproxy_client_circuit_state_changes_total", "circuit", key, "state", state.String())).Inc()
+}
+
+func (m *Metrics) observeCircuitRejected(key string) {
+	if m == nil {
+		return
+	}
+	m.set.GetOrCreateCounter(metricName("soapproxy_client_circuit_rejected_total", "circuit", key)).Inc()
+}
+
+func (m *Metrics) observeCache(operation string, hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.set.GetOrCreateCounter(metricName("soapproxy_cache_requests_total", "operation", operation, "result", result)).Inc()
+}
+
+func (m *Metrics) observeClientCache(action string, hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.set.GetOrCreateCounter(metricName("soapproxy_client_cache_requests_total", "action", action, "result", result)).Inc()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricName returns name{k1="v1",k2="v2"} from the name and label key-value pairs.
+func metricName(name string, labels ...string) string {
+	var buf strings.Builder
+	buf.WriteString(name)
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i == 0 {
+			buf.WriteByte('{')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(labels[i])
+		buf.WriteString(`="`)
+		labelEscaper.WriteString(&buf, labels[i+1])
+		buf.WriteByte('"')
+	}
+	if len(labels) > 1 {
+		buf.WriteByte('}')
+	}
+	return buf.String()
+}
+
+// countingReader counts the bytes read.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
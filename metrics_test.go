@@ -0,0 +1,101 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	h := NewSOAPHandler(SOAPHandlerConfig{
+		Client: &stubClient{}, Logger: zlog.NewT(t).SLog(), Metrics: m,
+		Authorizer: &Policy{Operations: map[string]Rule{"Login": {Callers: []string{"bob"}}}, TrustBasicAuth: true},
+	})
+	for _, user := range []string{"bob", "carol"} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+		req.Header.Set("SOAPAction", "Login")
+		req.SetBasicAuth(user, "secret")
+		h.serveHTTP(httptest.NewRecorder(), req)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	got := rec.Body.String()
+	t.Log(got)
+	for _, want := range []string{
+		`soapproxy_requests_total{operation="Login"} 2`,
+		`soapproxy_faults_total{operation="Login",faultcode="soapenv:Client",grpc_code="Unknown"} 1`,
+		`soapproxy_request_duration_seconds_count{operation="Login",phase="decode"} 2`,
+		`soapproxy_request_duration_seconds_count{operation="Login",phase="call"} 1`,
+		`soapproxy_request_duration_seconds_count{operation="Login",phase="encode"} 1`,
+		`soapproxy_request_size_bytes_count{operation="Login"} 2`,
+		`soapproxy_response_parts_total{operation="Login"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
+
+func TestClientMetrics(t *testing.T) {
+	old := ClientMetrics
+	ClientMetrics = NewMetrics()
+	defer func() { ClientMetrics = old }()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, SOAPHeader+SOAPBody+`<Resp><A>1</A></Resp>`+SOAPFooter)
+	}))
+	defer srv.Close()
+	var resp struct{ A int }
+	if err := SOAPCall(context.Background(), srv.URL, "Act", "<Req/>", &resp, zlog.NewT(t).SLog()); err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	ClientMetrics.WritePrometheus(&buf)
+	got := buf.String()
+	t.Log(got)
+	for _, want := range []string{
+		`soapproxy_client_requests_total{action="Act",status="200"} 1`,
+		`soapproxy_client_request_duration_seconds_count{action="Act"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+
+	// the Client's own Metrics is used instead of the package default
+	c := Client{URL: srv.URL, Logger: zlog.NewT(t).SLog(), Metrics: NewMetrics()}
+	if err := c.Call(context.Background(), "Own", "<Req/>", &resp); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	c.Metrics.WritePrometheus(&buf)
+	if want := `soapproxy_client_requests_total{action="Own",status="200"} 1`; !strings.Contains(buf.String(), want) {
+		t.Errorf("missing %q from\n%s", want, buf.String())
+	}
+	buf.Reset()
+	ClientMetrics.WritePrometheus(&buf)
+	if strings.Contains(buf.String(), `action="Own"`) {
+		t.Errorf("the Client's call is in ClientMetrics:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package mockclient provides a grpcer.Client returning canned responses from a directory,
+// for local development without the real gRPC backend - see ../mockproxy.
+package mockclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/UNO-SOFT/grpcer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Client is a grpcer.Client returning canned responses from Dir, for local development
+// without the real gRPC backend.
+//
+// For each operation, Dir contains either
+//   - <operation>.xml with the response: each root element is a part, or
+//   - <operation>.json with a list of Rules: the first matching one is used.
+//
+// The files are read on each call, so they can be edited without a restart.
+//
+// The input of every operation is a generic one, which collects the text of the elements.
+type Client struct {
+	Dir string
+}
+
+// Rule is a canned response of an operation.
+type Rule struct {
+	// When are the predicates on the input fields, all of them must match.
+	// The key is the dot-separated path of the element names below the input element,
+	// the predicate is either the value, "~regexp", "!value" (not equal) or "*" (present).
+	When map[string]string `json:"when,omitempty"`
+	// Fault is returned if set, instead of the Response.
+	Fault *Fault `json:"fault,omitempty"`
+	// Response is the file name (relative to Dir) of the response.
+	Response string `json:"response,omitempty"`
+}
+
+// Fault is the gRPC error returned by a Rule.
+type Fault struct {
+	Message string     `json:"message"`
+	Code    codes.Code `json:"code"`
+}
+
+var _ grpcer.Client = Client{}
+
+// List the operations in Dir.
+func (m Client) List() []string {
+	des, _ := os.ReadDir(m.Dir)
+	names := make([]string, 0, len(des))
+	for _, de := range des {
+		nm := de.Name()
+		if k := strings.TrimSuffix(strings.TrimSuffix(nm, ".xml"), ".json"); k != nm && !slices.Contains(names, k) {
+			names = append(names, k)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Input returns a generic input, collecting the text of the elements.
+func (m Client) Input(name string) any { return &mockInput{} }
+
+// Call returns the response of the first matching rule of the operation.
+func (m Client) Call(name string, ctx context.Context, input any, opts ...grpc.CallOption) (grpcer.Receiver, error) {
+	root, err := os.OpenRoot(m.Dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	rules, err := mockRules(root, name)
+	if err != nil {
+		return nil, err
+	}
+	inp, _ := input.(*mockInput)
+	for _, rule := range rules {
+		if ok, err := rule.matches(inp); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		} else if !ok {
+			continue
+		}
+		if rule.Fault != nil {
+			return nil, status.Error(rule.Fault.Code, rule.Fault.Message)
+		}
+		b, err := root.ReadFile(rule.Response)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		parts, err := parseMockParts(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", rule.Response, err)
+		}
+		return &receiver{parts: parts}, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "no matching mock response for %s", name)
+}
+
+// receiver returns the parts one by one.
+type receiver struct{ parts []any }
+
+func (r *receiver) Recv() (any, error) {
+	if len(r.parts) == 0 {
+		return nil, io.EOF
+	}
+	part := r.parts[0]
+	r.parts = r.parts[1:]
+	return part, nil
+}
+
+// mockRules returns the rules of the operation: from <name>.json, or <name>.xml.
+func mockRules(root *os.Root, name string) ([]Rule, error) {
+	b, err := root.ReadFile(name + ".json")
+	if err == nil {
+		var rules []Rule
+		if err = json.Unmarshal(b, &rules); err != nil {
+			return nil, fmt.Errorf("%s.json: %w", name, err)
+		}
+		return rules, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if _, err = root.Stat(name + ".xml"); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, status.Errorf(codes.Unimplemented, "no mock for %s", name)
+		}
+		return nil, err
+	}
+	return []Rule{{Response: name + ".xml"}}, nil
+}
+
+func (rule Rule) matches(inp *mockInput) (bool, error) {
+	for k, pred := range rule.When {
+		var values []string
+		if inp != nil {
+			values = inp.fields[k]
+		}
+		var ok bool
+		switch {
+		case pred == "*":
+			ok = len(values) != 0
+		case strings.HasPrefix(pred, "~"):
+			rx, err := regexp.Compile(pred[1:])
+			if err != nil {
+				return false, fmt.Errorf("%s: %w", k, err)
+			}
+			ok = slices.ContainsFunc(values, rx.MatchString)
+		case strings.HasPrefix(pred, "!"):
+			ok = !slices.Contains(values, pred[1:])
+		default:
+			ok = slices.Contains(values, pred)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// mockInput collects the text of the elements, by their dot-separated path.
+type mockInput struct {
+	fields map[string][]string
+}
+
+func (mi *mockInput) UnmarshalXML(dec *xml.Decoder, st xml.StartElement) error {
+	mi.fields = make(map[string][]string)
+	var path []string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch x := tok.(type) {
+		case xml.StartElement:
+			path = append(path, x.Name.Local)
+		case xml.EndElement:
+			if len(path) == 0 {
+				return nil
+			}
+			path = path[:len(path)-1]
+		case xml.CharData:
+			if x = bytes.TrimSpace(x); len(x) != 0 && len(path) != 0 {
+				k := strings.Join(path, ".")
+				mi.fields[k] = append(mi.fields[k], string(x))
+			}
+		}
+	}
+}
+
+func (mi *mockInput) MarshalJSON() ([]byte, error) { return json.Marshal(mi.fields) }
+
+// mockPart is a canned response part, marshaled as is.
+type mockPart struct {
+	tokens []xml.Token
+}
+
+// mockPartType is the captured type name of the mockParts.
+var mockPartType = reflect.TypeFor[*mockPart]().String()
+
+// NewPart returns a new part for the captured type name of the Client's parts, or nil for the others:
+// the newPart of soapproxy.ReplayDir.
+func NewPart(typeName string) any {
+	if typeName == mockPartType {
+		return &mockPart{}
+	}
+	return nil
+}
+
+// MarshalJSON returns the XML of the part as a JSON string, for the captures.
+func (mp *mockPart) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := mp.MarshalXML(xml.NewEncoder(&buf), xml.StartElement{}); err != nil {
+		return nil, err
+	}
+	return json.Marshal(buf.String())
+}
+
+// UnmarshalJSON parses the XML in the JSON string, as MarshalJSON wrote it.
+func (mp *mockPart) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parts, err := parseMockParts([]byte(s))
+	if err != nil {
+		return err
+	}
+	if len(parts) != 1 {
+		return fmt.Errorf("got %d parts, wanted 1", len(parts))
+	}
+	*mp = *parts[0].(*mockPart)
+	return nil
+}
+
+// parseMockParts returns each root element as a part.
+func parseMockParts(b []byte) ([]any, error) {
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	var parts []any
+	var part *mockPart
+	var depth int
+	for {
+		tok, err := dec.RawToken()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return parts, nil
+			}
+			return parts, err
+		}
+		switch x := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				part = &mockPart{}
+				parts = append(parts, part)
+			}
+			depth++
+			// keep the prefixes and namespace declarations as is
+			x.Name = rawName(x.Name)
+			x.Attr = slices.Clone(x.Attr)
+			for i, a := range x.Attr {
+				x.Attr[i].Name = rawName(a.Name)
+			}
+			tok = x
+		case xml.EndElement:
+			depth--
+			x.Name = rawName(x.Name)
+			tok = x
+		case xml.ProcInst, xml.Directive:
+			continue
+		default:
+			if depth == 0 {
+				continue
+			}
+		}
+		part.tokens = append(part.tokens, xml.CopyToken(tok))
+	}
+}
+
+// rawName returns the prefixed name as Local, for the xml.Encoder to write it as is.
+func rawName(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
+
+// MarshalXML writes the tokens, ignoring start.
+func (mp *mockPart) MarshalXML(enc *xml.Encoder, _ xml.StartElement) error {
+	for _, tok := range mp.tokens {
+		if err := enc.EncodeToken(tok); err != nil {
+			return err
+		}
+	}
+	return enc.Flush()
+}
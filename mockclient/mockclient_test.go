@@ -0,0 +1,116 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mockclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	soapproxy "github.com/UNO-SOFT/soap-proxy"
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+const loginRequest = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>
+<DbDealer_Login><PLoginNev>b0917174</PLoginNev><PJelszo>b0917174</PJelszo></DbDealer_Login>
+</soap:Body></soap:Envelope>`
+
+func TestClient(t *testing.T) {
+	dir := t.TempDir()
+	for nm, content := range map[string]string{
+		"Login.json": `[
+	{"when": {"PLoginNev": "b0917174", "PJelszo": "!wrong"}, "response": "Login-ok.xml"},
+	{"when": {"PLoginNev": "~^x"}, "fault": {"code": "PERMISSION_DENIED", "message": "nope"}}
+]`,
+		"Login-ok.xml": `<?xml version="1.0"?>
+<Login_Output xmlns="urn:test" xmlns:t="urn:t"><PHibaKod>0</PHibaKod><t:PSessionId>s1</t:PSessionId></Login_Output>`,
+		"Logout.xml": `<Logout_Output><PHibaKod>1</PHibaKod></Logout_Output>`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, nm), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := Client{Dir: dir}
+	if got := strings.Join(m.List(), ","); got != "Login,Login-ok,Logout" {
+		t.Errorf("List: got %q", got)
+	}
+
+	h := soapproxy.NewSOAPHandler(soapproxy.SOAPHandlerConfig{Client: m, Logger: zlog.NewT(t).SLog()})
+	for nm, tc := range map[string]struct {
+		Action, Request string
+		Code            int
+		Want            string
+	}{
+		"ok":        {"Login", loginRequest, 200, `<Login_Output xmlns="urn:test" xmlns:t="urn:t"><PHibaKod>0</PHibaKod><t:PSessionId>s1</t:PSessionId></Login_Output>`},
+		"denied":    {"Login", strings.Replace(loginRequest, "<PLoginNev>b0917174", "<PLoginNev>x", 1), 401, "nope"},
+		"nomatch":   {"Login", strings.Replace(loginRequest, "<PJelszo>b0917174", "<PJelszo>wrong", 1), 500, "no matching mock response"},
+		"plain":     {"Logout", loginRequest, 200, `<Logout_Output><PHibaKod>1</PHibaKod></Logout_Output>`},
+		"notmocked": {"Other", loginRequest, 500, "no mock for Other"},
+	} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(tc.Request))
+		req.Header.Set("SOAPAction", tc.Action)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		got := w.Body.String()
+		if w.Code != tc.Code || !strings.Contains(got, tc.Want) {
+			t.Errorf("%s: got %d %s, wanted %d %s", nm, w.Code, got, tc.Code, tc.Want)
+		}
+	}
+}
+
+func TestReplayReport(t *testing.T) {
+	mockDir, dir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(mockDir, "Logout.xml"), []byte(`<Logout_Output xmlns:t="urn:t"><t:PHibaKod>1</t:PHibaKod></Logout_Output>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := soapproxy.SOAPHandlerConfig{Client: Client{Dir: mockDir}, Logger: zlog.NewT(t).SLog()}
+	capConf := conf
+	capConf.CaptureDir = dir
+	req := httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+	req.Header.Set("SOAPAction", "Logout")
+	soapproxy.NewSOAPHandler(capConf).ServeHTTP(httptest.NewRecorder(), req)
+
+	// the mock parts are replayed without the mock directory
+	conf.Client = Client{}
+	var buf strings.Builder
+	if err := soapproxy.ReplayReport(context.Background(), conf, dir, NewPart, &buf); err != nil {
+		t.Fatalf("%+v\n%s", err, buf.String())
+	}
+	if !strings.HasPrefix(buf.String(), "ok\t") {
+		t.Errorf("got %q", buf.String())
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(files[0], bytes.Replace(b, []byte(`\u003e1\u003c`), []byte(`\u003e2\u003c`), 1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err = soapproxy.ReplayReport(context.Background(), conf, dir, NewPart, &buf); !errors.Is(err, soapproxy.ErrReplayMismatch) {
+		t.Errorf("wanted ErrReplayMismatch, got %+v", err)
+	}
+	if got := buf.String(); !strings.HasPrefix(got, "FAIL\t") || !strings.Contains(got, "response: at ") {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Command mockproxy serves a SOAP endpoint with the given WSDL,
+// answering from the canned responses of a directory, without any gRPC backend.
+//
+// See mockclient.Client for the layout of the directory.
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+
+	soapproxy "github.com/UNO-SOFT/soap-proxy"
+	"github.com/UNO-SOFT/soap-proxy/mockclient"
+)
+
+func main() {
+	if err := Main(); err != nil {
+		slog.Error("main", "error", err)
+		os.Exit(1)
+	}
+}
+
+func Main() error {
+	flagAddr := flag.String("addr", "127.0.0.1:8080", "address to listen on")
+	flagWSDL := flag.String("wsdl", "", "WSDL file to serve")
+	flagDir := flag.String("dir", "mock", "directory of the canned responses")
+	flagLocation := flag.String("location", "", "endpoint location to put into the WSDL (http://<addr>/ by default)")
+	flagAnnotations := flag.String("annotations", "", "JSON or YAML file of the operations' annotations")
+	flagCapture := flag.String("capture", "", "directory to record the calls into, for soapreplay")
+	flagVerbose := flag.Bool("v", false, "verbose logging")
+	flag.Parse()
+
+	var level slog.Level
+	if *flagVerbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	var wsdl string
+	if *flagWSDL != "" {
+		b, err := os.ReadFile(*flagWSDL)
+		if err != nil {
+			return err
+		}
+		wsdl = string(b)
+	}
+	location := *flagLocation
+	if location == "" {
+		location = "http://" + *flagAddr + "/"
+	}
+	conf := soapproxy.SOAPHandlerConfig{
+		Client:     mockclient.Client{Dir: *flagDir},
+		Logger:     logger,
+		WSDL:       wsdl,
+		Locations:  []string{location},
+		CaptureDir: *flagCapture,
+	}
+	if *flagAnnotations != "" {
+		var err error
+		if conf.Annotations, err = soapproxy.LoadAnnotations(*flagAnnotations); err != nil {
+			return err
+		}
+	}
+	h, err := conf.New()
+	if err != nil {
+		return err
+	}
+	logger.Info("listening", "addr", *flagAddr, "dir", *flagDir, "operations", mockclient.Client{Dir: *flagDir}.List())
+	return http.ListenAndServe(*flagAddr, h)
+}
@@ -0,0 +1,268 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned (wrapped) when a rate or concurrency limit is exceeded.
+var ErrRateLimited = errors.New("rate limited")
+
+// RateLimit is a token-bucket rate limit combined with a max-in-flight limit.
+type RateLimit struct {
+	// Rate is the allowed number of requests per second. Zero means unlimited.
+	Rate float64 `json:"rate,omitempty"`
+	// Burst is the token bucket size, at least 1.
+	Burst int `json:"burst,omitempty"`
+	// MaxInFlight is the maximum number of concurrent calls. Zero means unlimited.
+	MaxInFlight int `json:"maxInFlight,omitempty"`
+}
+
+// RateLimiterConfig is the configuration of the RateLimiter.
+//
+// Each map is keyed by operation name or caller key, with "*" as the default for the missing keys.
+// A caller key is "mtls:CommonName", "token:subject", "basic:username@address" (as the proxy does not verify the password)
+// or "ip:address" for anonymous callers.
+type RateLimiterConfig struct {
+	// Operations limits are shared by all callers of the operation.
+	Operations map[string]RateLimit `json:"operations,omitempty"`
+	// Callers limits are per caller, shared by all the operations.
+	Callers map[string]RateLimit `json:"callers,omitempty"`
+	// IdleTimeout is the time after the state of an idle caller is forgotten (10 minutes by default).
+	IdleTimeout time.Duration `json:"idleTimeout,omitempty"`
+}
+
+// RateLimiter limits the calls by operation and by caller.
+type RateLimiter struct {
+	limiters  map[string]*limiter
+	lastPurge time.Time
+	RateLimiterConfig
+	mu sync.Mutex
+}
+
+type limiter struct {
+	lastUsed atomic.Int64
+	*rate.Limiter
+	key      string
+	inFlight atomic.Int64
+	rejected atomic.Uint64
+	RateLimit
+}
+
+// NewRateLimiter returns a new RateLimiter.
+func NewRateLimiter(conf RateLimiterConfig) *RateLimiter {
+	if conf.IdleTimeout <= 0 {
+		conf.IdleTimeout = 10 * time.Minute
+	}
+	return &RateLimiter{RateLimiterConfig: conf, limiters: make(map[string]*limiter)}
+}
+
+// addOperations adds the operation limits which are not configured yet.
+func (rl *RateLimiter) addOperations(limits map[string]RateLimit) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	ops := maps.Clone(rl.Operations)
+	if ops == nil {
+		ops = make(map[string]RateLimit, len(limits))
+	}
+	for k, v := range limits {
+		if _, ok := ops[k]; !ok {
+			ops[k] = v
+		}
+	}
+	rl.Operations = ops
+}
+
+// callerLimitKey returns the key of the caller: its verified identity, or the remote IP for anonymous callers.
+// The unverified Basic usernames are qualified by the remote IP, so a client cannot pick another user's bucket.
+func callerLimitKey(caller Caller, r *http.Request) string {
+	if caller.Verified() {
+		return caller.Method + ":" + caller.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if caller.Method != "" {
+		return caller.Method + ":" + caller.Name + "@" + host
+	}
+	return "ip:" + host
+}
+
+// Acquire the operation and caller limits.
+// On success, the returned release function must be called when the call has finished.
+func (rl *RateLimiter) Acquire(operation, callerKey string) (release func(), err error) {
+	now := time.Now()
+	var acquired []*limiter
+	var reserved []*rate.Reservation
+	release = func() {
+		for _, l := range acquired {
+			l.inFlight.Add(-1)
+		}
+	}
+	// reject releases the acquired limits, and gives back the tokens already taken.
+	reject := func() {
+		release()
+		for _, r := range reserved {
+			r.CancelAt(now)
+		}
+	}
+	for _, k := range [...]struct{ kind, key string }{{"operation", operation}, {"caller", callerKey}} {
+		l := rl.get(k.kind, k.key, now)
+		if l == nil {
+			continue
+		}
+		if l.MaxInFlight > 0 {
+			if l.inFlight.Add(1) > int64(l.MaxInFlight) {
+				l.inFlight.Add(-1)
+				l.rejected.Add(1)
+				reject()
+				return nil, &rateLimitError{key: l.key, retryAfter: time.Second,
+					error: fmt.Errorf("%s: more than %d calls in flight: %w", l.key, l.MaxInFlight, ErrRateLimited)}
+			}
+			acquired = append(acquired, l)
+		}
+		if l.Limiter != nil {
+			r := l.ReserveN(now, 1)
+			if !r.OK() || r.DelayFrom(now) > 0 {
+				retryAfter := time.Second
+				if r.OK() {
+					retryAfter = r.DelayFrom(now)
+					r.CancelAt(now)
+				}
+				l.rejected.Add(1)
+				reject()
+				return nil, &rateLimitError{key: l.key, retryAfter: retryAfter,
+					error: fmt.Errorf("%s: rate %g/s exceeded: %w", l.key, l.Rate, ErrRateLimited)}
+			}
+			reserved = append(reserved, r)
+		}
+	}
+	return release, nil
+}
+
+// get the limiter for the key, creating it if needed. Returns nil if there's no limit configured.
+func (rl *RateLimiter) get(kind, key string, now time.Time) *limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	var limits map[string]RateLimit
+	if kind == "operation" {
+		limits = rl.Operations
+	} else {
+		limits = rl.Callers
+	}
+	lim, ok := limits[key]
+	if !ok {
+		if lim, ok = limits["*"]; !ok {
+			return nil
+		}
+	}
+	if lim.Rate <= 0 && lim.MaxInFlight <= 0 {
+		return nil
+	}
+	k := kind + "/" + key
+	if now.Sub(rl.lastPurge) > rl.IdleTimeout {
+		rl.lastPurge = now
+		for k, l := range rl.limiters {
+			if l.inFlight.Load() == 0 && now.Sub(time.Unix(0, l.lastUsed.Load())) > rl.IdleTimeout {
+				delete(rl.limiters, k)
+			}
+		}
+	}
+	l := rl.limiters[k]
+	if l == nil {
+		l = &limiter{key: k, RateLimit: lim}
+		if lim.Rate > 0 {
+			l.Limiter = rate.NewLimiter(rate.Limit(lim.Rate), max(1, lim.Burst))
+		}
+		rl.limiters[k] = l
+	}
+	l.lastUsed.Store(now.UnixNano())
+	return l
+}
+
+// LimiterState is the current state of a limiter.
+type LimiterState struct {
+	Key      string  `json:"key"`
+	Tokens   float64 `json:"tokens"`
+	InFlight int64   `json:"inFlight"`
+	Rejected uint64  `json:"rejected"`
+	RateLimit
+}
+
+// State returns the current state of the limiters, sorted by key.
+func (rl *RateLimiter) State() []LimiterState {
+	now := time.Now()
+	rl.mu.Lock()
+	states := make([]LimiterState, 0, len(rl.limiters))
+	for _, l := range rl.limiters {
+		st := LimiterState{Key: l.key, RateLimit: l.RateLimit,
+			InFlight: l.inFlight.Load(), Rejected: l.rejected.Load(),
+			Tokens: math.Inf(1),
+		}
+		if l.Limiter != nil {
+			st.Tokens = l.TokensAt(now)
+		}
+		states = append(states, st)
+	}
+	rl.mu.Unlock()
+	slices.SortFunc(states, func(a, b LimiterState) int { return strings.Compare(a.Key, b.Key) })
+	return states
+}
+
+// ServeHTTP serves the State as JSON, for monitoring.
+func (rl *RateLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	states := rl.State()
+	for i, st := range states {
+		if math.IsInf(st.Tokens, 0) {
+			states[i].Tokens = -1
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(states)
+}
+
+// rateLimitError is mapped to 429 with a Retry-After header and soapenv:Client fault.
+type rateLimitError struct {
+	error
+	key        string
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Unwrap() error       { return e.error }
+func (e *rateLimitError) Code() int           { return http.StatusTooManyRequests }
+func (e *rateLimitError) FaultCode() string   { return prefix + ":Client" }
+func (e *rateLimitError) FaultString() string { return e.Error() }
+
+// RetryAfter returns the value for the Retry-After header, in seconds.
+func (e *rateLimitError) RetryAfter() string {
+	return strconv.Itoa(int(math.Ceil(max(e.retryAfter, time.Second).Seconds())))
+}
@@ -0,0 +1,128 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := NewRateLimiter(RateLimiterConfig{
+		Operations: map[string]RateLimit{"Login": {MaxInFlight: 2}},
+		Callers:    map[string]RateLimit{"*": {Rate: 0.001, Burst: 2}},
+	})
+	release1, err := rl.Acquire("Login", "basic:a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release2, err := rl.Acquire("Login", "basic:b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rl.Acquire("Login", "basic:c"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("in-flight: wanted ErrRateLimited, got %+v", err)
+	}
+	release1()
+	release2()
+
+	if _, err = rl.Acquire("Other", "basic:a"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = rl.Acquire("Other", "basic:a")
+	var rle *rateLimitError
+	if !errors.As(err, &rle) {
+		t.Fatalf("rate: wanted rateLimitError, got %+v", err)
+	}
+	if rle.RetryAfter() == "1" {
+		t.Errorf("Retry-After should be much longer, got %s", rle.RetryAfter())
+	}
+
+	states := rl.State()
+	t.Logf("states: %+v", states)
+	if len(states) != 3 { // basic:c was rejected by the operation limit
+		t.Errorf("got %d states, wanted 3", len(states))
+	}
+	for _, st := range states {
+		if st.InFlight != 0 {
+			t.Errorf("%s: %d in flight", st.Key, st.InFlight)
+		}
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	h := NewSOAPHandler(SOAPHandlerConfig{
+		Client: &stubClient{}, Logger: zlog.NewT(t).SLog(),
+		RateLimiter: NewRateLimiter(RateLimiterConfig{Callers: map[string]RateLimit{"*": {Rate: 0.001}}}),
+	})
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+		req.Header.Set("SOAPAction", "Login")
+		rec := httptest.NewRecorder()
+		h.serveHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%d. got %d, wanted %d", i, rec.Code, want)
+		}
+		if want == http.StatusTooManyRequests {
+			if rec.Header().Get("Retry-After") == "" {
+				t.Error("no Retry-After header")
+			}
+			if !strings.Contains(rec.Body.String(), "soapenv:Client") {
+				t.Errorf("no Client fault: %s", rec.Body.String())
+			}
+		}
+	}
+}
+
+func TestRateLimiterRejectGivesBack(t *testing.T) {
+	rl := NewRateLimiter(RateLimiterConfig{
+		Operations: map[string]RateLimit{"*": {Rate: 0.001, Burst: 2}},
+		Callers:    map[string]RateLimit{"*": {Rate: 0.001, Burst: 1}},
+	})
+	if _, err := rl.Acquire("Login", "token:a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.Acquire("Login", "token:a"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("wanted ErrRateLimited, got %+v", err)
+	}
+	// the rejected call must not have used the operation's last token
+	if _, err := rl.Acquire("Login", "token:b"); err != nil {
+		t.Errorf("operation bucket drained by a rejected call: %+v", err)
+	}
+}
+
+func TestCallerLimitKey(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	for _, tc := range []struct {
+		Caller Caller
+		Want   string
+	}{
+		{Caller{}, "ip:192.0.2.1"},
+		{Caller{Method: "basic", Name: "bob"}, "basic:bob@192.0.2.1"},
+		{Caller{Method: "token", Name: "bob"}, "token:bob"},
+		{Caller{Method: "mtls", Name: "bob"}, "mtls:bob"},
+	} {
+		if got := callerLimitKey(tc.Caller, req); got != tc.Want {
+			t.Errorf("%+v: got %q, wanted %q", tc.Caller, got, tc.Want)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const redacted = "***"
+
+// DefaultRedactedHeaders are the HTTP headers always masked by the Redactor.
+//
+// The SOAPAction is masked, too, as the logs name the operation anyway,
+// and some clients put their credentials or session ids into it.
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+	"SOAPAction", "X-Api-Key", "X-Auth-Token"}
+
+// ClientRedactor masks the sensitive data in the logs of the SOAPCall* functions,
+// and of the Clients without a Redactor.
+// If nil, only the DefaultRedactedHeaders are masked.
+var ClientRedactor *Redactor
+
+// RedactorConfig is the configuration of the Redactor.
+type RedactorConfig struct {
+	// Fields are the XML element and JSON field names whose values are masked.
+	Fields []string
+	// Patterns are regular expressions masked wherever they match (tax IDs, bank account numbers...).
+	Patterns []string
+	// Headers are the HTTP headers to mask, besides the DefaultRedactedHeaders.
+	Headers []string
+}
+
+// Redactor masks the sensitive data in the logs, the audit records and the debug output.
+//
+// The field names are matched case-insensitively, ignoring '_' and '-',
+// so "PJelszo" matches both the <PJelszo> XML element and the "p_jelszo" JSON field.
+// The fields of structs tagged with `redact:""` are masked, too.
+//
+// A nil Redactor masks only the DefaultRedactedHeaders.
+type Redactor struct {
+	fields   map[string]struct{}
+	headers  []string
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor returns a new Redactor.
+func NewRedactor(conf RedactorConfig) (*Redactor, error) {
+	r := Redactor{
+		fields:  make(map[string]struct{}, len(conf.Fields)),
+		headers: make([]string, 0, len(DefaultRedactedHeaders)+len(conf.Headers)),
+	}
+	for _, f := range conf.Fields {
+		r.fields[normalizeField(f)] = struct{}{}
+	}
+	for _, h := range slices.Concat(DefaultRedactedHeaders, conf.Headers) {
+		r.headers = append(r.headers, http.CanonicalHeaderKey(h))
+	}
+	for _, p := range conf.Patterns {
+		rx, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, rx)
+	}
+	return &r, nil
+}
+
+// RedactFields returns an AuditSink which masks the named fields before passing the record to sink.
+func RedactFields(sink AuditSink, names ...string) AuditSink {
+	r, _ := NewRedactor(RedactorConfig{Fields: names})
+	return r.AuditSink(sink)
+}
+
+func normalizeField(s string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(s))
+}
+
+func (r *Redactor) match(name string, tagged map[string]struct{}) bool {
+	name = normalizeField(name)
+	if _, ok := r.fields[name]; ok {
+		return true
+	}
+	_, ok := tagged[name]
+	return ok
+}
+
+// String masks the matches of the patterns.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, rx := range r.patterns {
+		s = rx.ReplaceAllLiteralString(s, redacted)
+	}
+	return s
+}
+
+// XML masks the text content of the matching elements, and the matches of the patterns.
+//
+// The not parseable rest of the XML (e.g. of a truncated envelope) is replaced by "...".
+func (r *Redactor) XML(s string) string {
+	if r == nil {
+		return s
+	}
+	if len(r.fields) != 0 && strings.Contains(s, "<") {
+		s = redactXML(s, func(name string) bool { return r.match(name, nil) })
+	}
+	return r.String(s)
+}
+
+// redactXML replaces the text content of the matching elements with "***".
+//
+// An end tag without its start tag (the cut started inside that element) is matched, too,
+// masking all the text before it.
+func redactXML(s string, match func(string) bool) string {
+	dec := xml.NewDecoder(strings.NewReader(s))
+	dec.Strict = false
+	type text struct {
+		start, end int
+		mask       bool
+	}
+	var texts []text
+	var depth, open int
+	cut, rest := len(s), ""
+	for {
+		before := int(dec.InputOffset())
+		tok, err := dec.RawToken()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				cut, rest = before, "..."
+			}
+			break
+		}
+		switch x := tok.(type) {
+		case xml.StartElement:
+			if depth != 0 {
+				depth++
+			} else if match(x.Name.Local) {
+				depth = 1
+			} else {
+				open++
+			}
+		case xml.EndElement:
+			if depth != 0 {
+				depth--
+			} else if open != 0 {
+				open--
+			} else if match(x.Name.Local) {
+				for i := range texts {
+					texts[i].mask = true
+				}
+			}
+		case xml.CharData:
+			if len(bytes.TrimSpace(x)) != 0 {
+				texts = append(texts, text{start: before, end: int(dec.InputOffset()), mask: depth != 0})
+			}
+		}
+	}
+	var buf strings.Builder
+	var last int
+	for _, t := range texts {
+		if t.mask {
+			buf.WriteString(s[last:t.start])
+			buf.WriteString(redacted)
+			last = t.end
+		}
+	}
+	buf.WriteString(s[last:cut])
+	buf.WriteString(rest)
+	return buf.String()
+}
+
+// JSON masks the values of the matching fields, and the matches of the patterns in the values.
+//
+// Not JSON input is masked by the patterns only.
+func (r *Redactor) JSON(s string) string {
+	if r == nil {
+		return s
+	}
+	return r.redactJSON(s, nil)
+}
+
+func (r *Redactor) redactJSON(s string, tagged map[string]struct{}) string {
+	if len(r.fields) == 0 && len(r.patterns) == 0 && len(tagged) == 0 {
+		return s
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return r.String(s)
+	}
+	b, err := json.Marshal(r.redactValue(v, tagged))
+	if err != nil {
+		return r.String(s)
+	}
+	return string(b)
+}
+
+func (r *Redactor) redactValue(v any, tagged map[string]struct{}) any {
+	switch x := v.(type) {
+	case map[string]any:
+		for k, v := range x {
+			if r.match(k, tagged) {
+				x[k] = redacted
+			} else {
+				x[k] = r.redactValue(v, tagged)
+			}
+		}
+	case []any:
+		for i, v := range x {
+			x[i] = r.redactValue(v, tagged)
+		}
+	case string:
+		return r.String(x)
+	case json.Number:
+		if s := r.String(string(x)); s != string(x) {
+			return s
+		}
+	}
+	return v
+}
+
+// Value returns the JSON representation of v, masked as JSON,
+// including the fields tagged with `redact:""`.
+func (r *Redactor) Value(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%#v", v)
+	}
+	tagged := taggedFields(reflect.TypeOf(v))
+	if r == nil {
+		if len(tagged) == 0 {
+			return string(b)
+		}
+		r = &Redactor{}
+	}
+	return r.redactJSON(string(b), tagged)
+}
+
+var taggedFieldsCache sync.Map
+
+// taggedFields returns the normalized names of the fields tagged with `redact:""` in t.
+func taggedFields(t reflect.Type) map[string]struct{} {
+	if t == nil {
+		return nil
+	}
+	if m, ok := taggedFieldsCache.Load(t); ok {
+		return m.(map[string]struct{})
+	}
+	m := make(map[string]struct{})
+	seen := make(map[reflect.Type]struct{})
+	var collect func(reflect.Type)
+	collect = func(t reflect.Type) {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		if _, ok := seen[t]; ok {
+			return
+		}
+		seen[t] = struct{}{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			if _, ok := f.Tag.Lookup("redact"); ok {
+				m[normalizeField(f.Name)] = struct{}{}
+				for _, k := range []string{"json", "xml"} {
+					nm, _, _ := strings.Cut(f.Tag.Get(k), ",")
+					if i := strings.LastIndexAny(nm, "> "); i >= 0 {
+						nm = nm[i+1:]
+					}
+					if nm != "" && nm != "-" {
+						m[normalizeField(nm)] = struct{}{}
+					}
+				}
+			}
+			collect(f.Type)
+		}
+	}
+	collect(t)
+	taggedFieldsCache.Store(t, m)
+	return m
+}
+
+// Header returns a copy of h with the sensitive headers masked,
+// and the matches of the patterns masked in the rest.
+func (r *Redactor) Header(h http.Header) http.Header {
+	h = h.Clone()
+	headers := DefaultRedactedHeaders
+	if r != nil {
+		headers = r.headers
+	}
+	for _, k := range headers {
+		if vv := h.Values(k); len(vv) != 0 {
+			h[http.CanonicalHeaderKey(k)] = []string{redacted}
+		}
+	}
+	if r != nil && len(r.patterns) != 0 {
+		for k, vv := range h {
+			for i, v := range vv {
+				vv[i] = r.String(v)
+			}
+			h[k] = vv
+		}
+	}
+	return h
+}
+
+// headTail returns the masked head and tail of the XML in sr, at most max bytes of it.
+// The head and the tail are masked separately, as the element boundaries may fall into the cut.
+func (r *Redactor) headTail(sr *io.SectionReader, max int64) string {
+	if sr.Size() <= max {
+		b := make([]byte, sr.Size())
+		n, _ := sr.ReadAt(b, 0)
+		return r.XML(string(b[:n]))
+	}
+	b := make([]byte, max)
+	n, _ := sr.ReadAt(b[:max/2], 0)
+	head := r.XML(string(b[:n]))
+	n, _ = sr.ReadAt(b[max/2:], sr.Size()-(max-max/2))
+	return head + " ... " + r.XML(string(b[max/2:max/2+int64(n)]))
+}
+
+// AuditSink returns an AuditSink which masks the records before passing them to sink.
+func (r *Redactor) AuditSink(sink AuditSink) AuditSink {
+	return AuditFunc(func(ctx context.Context, rec AuditRecord) error {
+		return sink.Audit(ctx, r.redactAudit(rec))
+	})
+}
+
+func (r *Redactor) redactAudit(rec AuditRecord) AuditRecord {
+	if r == nil {
+		return rec
+	}
+	rec.Request = r.XML(rec.Request)
+	rec.Response = r.XML(rec.Response)
+	if rec.Fault != nil {
+		f := *rec.Fault
+		f.String, f.Detail = r.String(f.String), r.XML(f.Detail)
+		rec.Fault = &f
+	}
+	return rec
+}
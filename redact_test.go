@@ -0,0 +1,145 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	r, err := NewRedactor(RedactorConfig{
+		Fields:   []string{"Secret", "PJelszo"},
+		Patterns: []string{`HU\d{26}`},
+		Headers:  []string{"X-Api-Key"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for in, want := range map[string]string{
+		`<a><Secret>x</Secret><b>y</b></a>`:                `<a><Secret>***</Secret><b>y</b></a>`,
+		`<a><p:Secret><c>x</c><d>z</d></p:Secret></a>`:     `<a><p:Secret><c>***</c><d>***</d></p:Secret></a>`,
+		`<a><Secret>x</Secret><b>y</b><Secret>trunc`:       `<a><Secret>***</Secret><b>y</b><Secret>***`,
+		`<a><Secret>x</Secret><b>y</b><Sec`:                `<a><Secret>***</Secret><b>y</b>...`,
+		`<a><Acct>HU12345678901234567890123456</Acct></a>`: `<a><Acct>***</Acct></a>`,
+		`not xml`: `not xml`,
+		// tail cuts
+		`cret123</PJelszo></Login></soap:Body></soap:Envelope>`: `***</PJelszo></Login></soap:Body></soap:Envelope>`,
+		`ret<c>x</c></Secret><b>y</b></a>`:                      `***<c>***</c></Secret><b>y</b></a>`,
+		`y</b><Secret>x</Secret></a>`:                           `y</b><Secret>***</Secret></a>`,
+	} {
+		if got := r.XML(in); got != want {
+			t.Errorf("XML %q: got %q, wanted %q", in, got, want)
+		}
+	}
+
+	envelope := `<soap:Envelope><soap:Body><Login><PLoginNev>bob</PLoginNev><PJelszo>secret123</PJelszo></Login></soap:Body></soap:Envelope>`
+	if got := r.headTail(io.NewSectionReader(strings.NewReader(envelope), 0, int64(len(envelope))), 100); strings.Contains(got, "123") {
+		t.Errorf("headTail: the tail leaks the password: %q", got)
+	}
+
+	if got, want := r.JSON(`{"p_login_nev":"bob","p_jelszo":"pw","acct":["HU12345678901234567890123456"]}`),
+		`{"acct":["***"],"p_jelszo":"***","p_login_nev":"bob"}`; got != want {
+		t.Errorf("JSON: got %q, wanted %q", got, want)
+	}
+
+	type tagged struct {
+		Name  string
+		TaxID string `json:"tax_id" redact:""`
+	}
+	if got, want := (*Redactor)(nil).Value([]tagged{{Name: "a", TaxID: "1234"}}),
+		`[{"Name":"a","tax_id":"***"}]`; got != want {
+		t.Errorf("Value: got %q, wanted %q", got, want)
+	}
+
+	hdr := http.Header{"Authorization": {"Basic xxx"}, "X-Api-Key": {"k"}, "Soapaction": {"Pay/HU12345678901234567890123456"}}
+	got := r.Header(hdr)
+	if got.Get("Authorization") != redacted || got.Get("X-Api-Key") != redacted || got.Get("SOAPAction") != redacted {
+		t.Errorf("Header: got %v", got)
+	}
+	if hdr.Get("Authorization") != "Basic xxx" {
+		t.Error("Header modified the original")
+	}
+	hdr.Set("X-Request-Id", "HU12345678901234567890123456")
+	if got := r.Header(hdr); got.Get("X-Request-Id") != "***" {
+		t.Errorf("Header pattern: got %v", got)
+	}
+	if got := (*Redactor)(nil).Header(hdr); got.Get("Authorization") != redacted || got.Get("X-Api-Key") != redacted || got.Get("SOAPAction") != redacted {
+		t.Errorf("nil Header: got %v", got)
+	}
+}
+
+func TestRedactLogs(t *testing.T) {
+	var buf strings.Builder
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	r, _ := NewRedactor(RedactorConfig{Fields: []string{"PJelszo", "Password"}})
+
+	var calls []string
+	h := NewSOAPHandler(SOAPHandlerConfig{Client: &stubClient{}, Logger: logger, Redactor: r,
+		LogRequest: func(_ context.Context, inp string, _ error) { calls = append(calls, inp) },
+	})
+	req := httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+	req.Header.Set("SOAPAction", "Login")
+	h.serveHTTP(httptest.NewRecorder(), req)
+	if len(calls) != 1 || !strings.Contains(calls[0], `"PJelszo":"***"`) {
+		t.Errorf("LogRequest got %q", calls)
+	}
+
+	// the decode error shows the head and tail of the request, masked
+	bad := strings.Replace(loginRequest, "<PJelszo>b0917174</PJelszo></DbDealer_Login></soap:Body></soap:Envelope>",
+		"<PJelszo>hunter3</PJelszo><PAddr>", 1)
+	req = httptest.NewRequest("POST", "/", strings.NewReader(bad))
+	req.Header.Set("SOAPAction", "Login")
+	rec := httptest.NewRecorder()
+	h.serveHTTP(rec, req)
+	if rec.Code == http.StatusOK || strings.Contains(rec.Body.String(), "hunter3") {
+		t.Errorf("decode error: got %d %s", rec.Code, rec.Body.String())
+	}
+
+	old := ClientRedactor
+	ClientRedactor = r
+	defer func() { ClientRedactor = old }()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, SOAPHeader+SOAPBody+`<Resp><Password>s3cr3t</Password></Resp>`+SOAPFooter)
+	}))
+	defer srv.Close()
+	var resp struct{ Password string }
+	if err := SOAPCallWithHeader(context.Background(), srv.URL,
+		func(r *http.Request) { r.SetBasicAuth("bob", "pw") }, nil,
+		"Act", "", "<Req><Password>hunter2</Password></Req>", &resp, logger,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Password != "s3cr3t" {
+		t.Errorf("got %q", resp.Password)
+	}
+	c := Client{URL: srv.URL, Logger: logger, Header: http.Header{"X-Session": {"sess1"}}}
+	if err := c.Call(context.Background(), "Act", "<Req/>", &resp); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	t.Log(got)
+	for _, leak := range []string{"hunter2", "hunter3", "s3cr3t", "sess1", "Basic Ym9i", "<PJelszo>b0917174"} {
+		if strings.Contains(got, leak) {
+			t.Errorf("log contains %q", leak)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/rogpeppe/retry"
+)
+
+// Attempt is one try of a call, to be classified whether it is worth retrying.
+type Attempt struct {
+	// Err is the error of the HTTP request, Response is nil if it is not nil.
+	Err      error
+	Response *http.Response
+	// Action is the SOAPAction of the call.
+	Action string
+	// FaultCode is the faultcode (SOAP 1.1) or Code/Value (SOAP 1.2) of the error response, if any.
+	FaultCode string
+	// Idempotent is set if the action can be repeated safely, even if it may have reached the server.
+	Idempotent bool
+}
+
+// DefaultRetryClassifier retries
+//   - the requests which has not reached the server (refused connection, DNS error),
+//   - 429 Too Many Requests, 502 Bad Gateway and 503 Service Unavailable responses,
+//
+// and, for idempotent actions only, the other network errors (timeout, reset connection)
+// and the 408 Request Timeout and 504 Gateway Timeout responses.
+//
+// SOAP faults are not retried.
+func DefaultRetryClassifier(a Attempt) bool {
+	if a.Err != nil {
+		if errors.Is(a.Err, context.Canceled) {
+			return false
+		}
+		return a.Idempotent || notSent(a.Err)
+	}
+	if a.Response == nil {
+		return false
+	}
+	switch a.Response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return true
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return a.Idempotent
+	}
+	return false
+}
+
+// notSent reports whether the error means that the request has not reached the server.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+type retryStrategyKey struct{}
+type idempotentKey struct{}
+
+// WithRetryStrategy overrides the retry strategy of the Client for the calls with the returned context.
+//
+// A zero Strategy disables retrying.
+func WithRetryStrategy(ctx context.Context, strategy retry.Strategy) context.Context {
+	if strategy == (retry.Strategy{}) {
+		strategy.MaxCount = 1
+	}
+	return context.WithValue(ctx, retryStrategyKey{}, strategy)
+}
+
+// WithIdempotent overrides whether the action is idempotent, for the calls with the returned context.
+func WithIdempotent(ctx context.Context, idempotent bool) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, idempotent)
+}
+
+// maxRetryAfter caps the delay requested by a Retry-After header.
+const maxRetryAfter = time.Hour
+
+// retryAfter returns the delay requested by the Retry-After header of the response, at most maxRetryAfter.
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	s := resp.Header.Get("Retry-After")
+	if s == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		// clamp before the multiplication can overflow
+		return time.Duration(min(max(n, 0), int(maxRetryAfter/time.Second))) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		return min(max(t.Sub(now), 0), maxRetryAfter)
+	}
+	return 0
+}
+
+// faultCode returns the code of the SOAP fault in b, if there's any.
+func faultCode(b []byte) string {
+	if !bytes.Contains(b, []byte("Fault")) {
+		return ""
+	}
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	st, err := FindBody(dec)
+	if err != nil || !isFault(st) {
+		return ""
+	}
+	fe, err := decodeFault(dec, st)
+	if err != nil {
+		return ""
+	}
+	return fe.Code
+}
@@ -0,0 +1,180 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/zlog/v2"
+	"github.com/rogpeppe/retry"
+)
+
+func TestRetryClassifier(t *testing.T) {
+	var n atomic.Int32
+	var mode atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n.Add(1) == 1 { // fail the first attempt
+			switch mode.Load().(string) {
+			case "close":
+				hj, _ := w.(http.Hijacker)
+				conn, _, _ := hj.Hijack()
+				conn.Close()
+			case "retry-after":
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			case "retry-after-huge":
+				w.Header().Set("Retry-After", "99999999999")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			case "fault":
+				w.WriteHeader(http.StatusInternalServerError)
+				io.WriteString(w, SOAPHeader+SOAPBody+`<soapenv:Fault><faultcode>soapenv:Server.Busy</faultcode><faultstring>busy</faultstring></soapenv:Fault>`+SOAPFooter)
+			default:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			return
+		}
+		io.WriteString(w, SOAPHeader+SOAPBody+`<Resp><A>1</A></Resp>`+SOAPFooter)
+	}))
+	defer srv.Close()
+
+	strategy := retry.Strategy{Delay: time.Millisecond, MaxCount: 3}
+	var gotFault string
+	c := Client{URL: srv.URL, Logger: zlog.NewT(t).SLog(), RetryStrategy: &strategy,
+		Idempotent: func(action string) bool { return action == "Get" },
+		RetryClassifier: func(a Attempt) bool {
+			if a.FaultCode != "" {
+				gotFault = a.FaultCode
+				return a.FaultCode == "soapenv:Server.Busy"
+			}
+			return DefaultRetryClassifier(a)
+		},
+	}
+	ctx := context.Background()
+	for _, tC := range []struct {
+		ctx        context.Context
+		name, mode string
+		action     string
+		wantTries  int32
+		wantErr    bool
+	}{
+		{name: "unavailable", action: "Set", wantTries: 2},
+		{name: "no retry", ctx: WithRetryStrategy(ctx, retry.Strategy{}), action: "Get", wantTries: 1, wantErr: true},
+		{name: "closed", mode: "close", action: "Set", wantTries: 1, wantErr: true},
+		{name: "closed idempotent", mode: "close", action: "Get", wantTries: 2},
+		{name: "closed WithIdempotent", ctx: WithIdempotent(ctx, true), mode: "close", action: "Set", wantTries: 2},
+		{name: "fault", mode: "fault", action: "Set", wantTries: 2},
+	} {
+		t.Run(tC.name, func(t *testing.T) {
+			n.Store(0)
+			mode.Store(tC.mode)
+			if tC.ctx == nil {
+				tC.ctx = ctx
+			}
+			var resp struct{ A int }
+			err := c.Call(tC.ctx, tC.action, "<Req/>", &resp)
+			if tC.wantErr != (err != nil) {
+				t.Errorf("got error %+v", err)
+			}
+			if got := n.Load(); got != tC.wantTries {
+				t.Errorf("got %d tries, wanted %d", got, tC.wantTries)
+			}
+		})
+	}
+	t.Run("legacy", func(t *testing.T) {
+		// the SOAPCall* functions retry the network errors, as they always did
+		n.Store(0)
+		mode.Store("close")
+		var resp struct{ A int }
+		if err := SOAPCallWithHeaderClient(ctx, nil, srv.URL, nil, nil, "Set", "", "<Req/>", &resp, zlog.NewT(t).SLog()); err != nil {
+			t.Fatal(err)
+		}
+		if got := n.Load(); got != 2 {
+			t.Errorf("got %d tries, wanted 2", got)
+		}
+	})
+	if gotFault != "soapenv:Server.Busy" {
+		t.Errorf("got fault code %q", gotFault)
+	}
+
+	t.Run("Retry-After", func(t *testing.T) {
+		n.Store(0)
+		mode.Store("retry-after")
+		start := time.Now()
+		var resp struct{ A int }
+		if err := c.Call(ctx, "Set", "<Req/>", &resp); err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(start); d < time.Second {
+			t.Errorf("retried after %s, wanted at least 1s", d)
+		}
+	})
+
+	t.Run("Retry-After beyond the deadline", func(t *testing.T) {
+		n.Store(0)
+		mode.Store("retry-after-huge")
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		start := time.Now()
+		var resp struct{ A int }
+		if err := c.Call(ctx, "Set", "<Req/>", &resp); err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("retried after %s, wanted the backoff", d)
+		}
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Now()
+	for s, want := range map[string]time.Duration{
+		"":            0,
+		"2":           2 * time.Second,
+		"-2":          0,
+		"99999999999": maxRetryAfter,
+		"soon":        0,
+		now.Add(-time.Minute).UTC().Format(http.TimeFormat):    0,
+		now.Add(100 * time.Hour).UTC().Format(http.TimeFormat): maxRetryAfter,
+	} {
+		resp := &http.Response{Header: http.Header{"Retry-After": {s}}}
+		if got := retryAfter(resp, now); got != want {
+			t.Errorf("%q: got %s, wanted %s", s, got, want)
+		}
+	}
+}
+
+func TestNotSent(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	_, err = http.Get("http://" + addr)
+	if err == nil {
+		t.Fatal("wanted error")
+	}
+	if !DefaultRetryClassifier(Attempt{Err: err}) {
+		t.Errorf("refused connection (%+v) should be retried", err)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OperationCache is the caching configuration of an operation.
+type OperationCache struct {
+	// TTL of the cached responses. Zero means not cached.
+	// In JSON, it is either a time.ParseDuration string ("5m") or seconds.
+	// If set in an annotation, it must be at least MinCacheTTL.
+	TTL time.Duration `json:"ttl,omitempty"`
+	// Shared responses are served to all the verified callers, not just to the same caller.
+	Shared bool `json:"shared,omitempty"`
+}
+
+// UnmarshalJSON decodes the OperationCache, rejecting the unknown keys.
+func (oc *OperationCache) UnmarshalJSON(b []byte) error {
+	var v struct {
+		TTL    json.RawMessage `json:"ttl"`
+		Shared bool            `json:"shared"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	var err error
+	oc.Shared = v.Shared
+	oc.TTL, err = parseJSONDuration(v.TTL)
+	return err
+}
+
+// ServerCacheConfig is the configuration of the ServerCache.
+type ServerCacheConfig struct {
+	// Store of the responses, NewLRUStore(MaxEntries) if nil.
+	Store CacheStore `json:"-"`
+	// Operations to cache, keyed by operation name, with "*" as the default for the missing ones.
+	// These override the Cache of the operations' annotations in the WSDL.
+	Operations map[string]OperationCache `json:"operations,omitempty"`
+	// MaxEntries of the default store, 1024 if zero.
+	MaxEntries int `json:"maxEntries,omitempty"`
+	// MaxEntrySize is the size limit of a cached response, 1MiB if zero.
+	MaxEntrySize int `json:"maxEntrySize,omitempty"`
+}
+
+// ServerCache caches the encoded SOAP responses of the read-only operations,
+// keyed by the operation, the SOAP header, the decoded input and the caller (unless Shared).
+//
+// Only the callers verified by the proxy itself (by token or client certificate) use the cache,
+// as a cached response is served without the backend checking the caller (e.g. its Basic password).
+// Only the complete, successful responses are cached.
+type ServerCache struct {
+	generations map[string]uint64
+	ServerCacheConfig
+	generation uint64
+	mu         sync.Mutex
+}
+
+// NewServerCache returns a new ServerCache.
+func NewServerCache(conf ServerCacheConfig) *ServerCache {
+	if conf.MaxEntries <= 0 {
+		conf.MaxEntries = 1024
+	}
+	if conf.MaxEntrySize <= 0 {
+		conf.MaxEntrySize = 1 << 20
+	}
+	if conf.Store == nil {
+		conf.Store = NewLRUStore(conf.MaxEntries)
+	}
+	return &ServerCache{ServerCacheConfig: conf, generations: make(map[string]uint64)}
+}
+
+// Invalidate the cached responses of the operations, or all of them if none is given.
+func (sc *ServerCache) Invalidate(operations ...string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if len(operations) == 0 {
+		sc.generation++
+		return
+	}
+	for _, op := range operations {
+		sc.generations[op]++
+	}
+}
+
+// config returns the caching configuration of the operation.
+func (sc *ServerCache) config(operation string, annotation *OperationCache) OperationCache {
+	if oc, ok := sc.Operations[operation]; ok {
+		return oc
+	}
+	if annotation != nil {
+		return *annotation
+	}
+	return sc.Operations["*"]
+}
+
+// key returns the cache key of the operation's response for the encoded SOAP header,
+// the input (as JSON) and caller.
+func (sc *ServerCache) key(operation string, header, inpJSON []byte, callerKey string) string {
+	sc.mu.Lock()
+	gen, opGen := sc.generation, sc.generations[operation]
+	sc.mu.Unlock()
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%d\x00%s\x00%d\x00", operation, gen, opGen, callerKey, len(header))
+	h.Write(header)
+	h.Write(inpJSON)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,139 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/grpcer"
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+func TestServerCache(t *testing.T) {
+	var callErr, recvErr error
+	cl := stubClient{Respond: func(ctx context.Context, name string) (grpcer.Receiver, error) {
+		if callErr != nil {
+			return nil, callErr
+		}
+		if recvErr != nil {
+			return &stubRecv{Parts: []any{&loginOutput{}, &loginOutput{}}, Err: recvErr}, nil
+		}
+		return &stubRecv{Parts: []any{&loginOutput{}}}, nil
+	}}
+	sc := NewServerCache(ServerCacheConfig{Operations: map[string]OperationCache{"Login": {TTL: time.Minute}}})
+	h := NewSOAPHandler(SOAPHandlerConfig{Client: &cl, Logger: zlog.NewT(t).SLog(), Cache: sc})
+	// call as the verified client certificate's owner, or by Basic auth if name starts with "basic:"
+	call := func(name string) string {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+		req.Header.Set("SOAPAction", "Login")
+		if user, ok := strings.CutPrefix(name, "basic:"); ok {
+			req.SetBasicAuth(user, "wrong")
+		} else {
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: name}}
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		rec := httptest.NewRecorder()
+		h.serveHTTP(rec, req)
+		if rec.Code != http.StatusOK && callErr == nil {
+			t.Fatalf("got %d: %s", rec.Code, rec.Body.String())
+		}
+		return rec.Body.String()
+	}
+
+	first := call("alice")
+	if second := call("alice"); second != first {
+		t.Errorf("cached response differs:\n%s\n%s", first, second)
+	}
+	if len(cl.Calls(false)) != 1 {
+		t.Errorf("same caller: got %d calls, wanted 1", len(cl.Calls(false)))
+	}
+	call("bob")
+	if len(cl.Calls(false)) != 2 {
+		t.Errorf("other caller: got %d calls, wanted 2", len(cl.Calls(false)))
+	}
+
+	sc.Invalidate("Login")
+	call("alice")
+	if len(cl.Calls(false)) != 3 {
+		t.Errorf("invalidated: got %d calls, wanted 3", len(cl.Calls(false)))
+	}
+
+	// the unverified callers are not served from the cache
+	call("basic:alice")
+	call("basic:alice")
+	if len(cl.Calls(false)) != 5 {
+		t.Errorf("basic: got %d calls, wanted 5", len(cl.Calls(false)))
+	}
+
+	// the response cut short is not cached
+	sc.Invalidate()
+	recvErr = errors.New("broken stream")
+	call("alice")
+	recvErr = nil
+	call("alice")
+	if len(cl.Calls(false)) != 7 {
+		t.Errorf("broken stream: got %d calls, wanted 7", len(cl.Calls(false)))
+	}
+
+	sc.Invalidate()
+	callErr = errors.New("boom")
+	call("alice")
+	call("alice")
+	if len(cl.Calls(false)) != 9 {
+		t.Errorf("fault: got %d calls, wanted 9", len(cl.Calls(false)))
+	}
+
+	if sc.key("Login", []byte("<T>1</T>"), []byte("{}"), "") == sc.key("Login", []byte("<T>2</T>"), []byte("{}"), "") {
+		t.Error("the SOAP header is not in the key")
+	}
+}
+
+func TestOperationCacheJSON(t *testing.T) {
+	var annotations map[string]Annotation
+	if err := json.Unmarshal([]byte(`{"A":{"Cache":{"ttl":"5m","shared":true}},"B":{"Cache":{"ttl":300}},"C":{"Raw":true}}`), &annotations); err != nil {
+		t.Fatal(err)
+	}
+	if got := annotations["A"].Cache; got == nil || got.TTL != 5*time.Minute || !got.Shared {
+		t.Errorf("A: got %+v", got)
+	}
+	if got := annotations["B"].Cache; got == nil || got.TTL != 5*time.Minute || got.Shared {
+		t.Errorf("B: got %+v", got)
+	}
+
+	sc := NewServerCache(ServerCacheConfig{Operations: map[string]OperationCache{
+		"A": {}, "*": {TTL: time.Second},
+	}})
+	if got := sc.config("A", annotations["A"].Cache); got.TTL != 0 {
+		t.Errorf("config should override the annotation, got %+v", got)
+	}
+	if got := sc.config("B", annotations["B"].Cache); got.TTL != 5*time.Minute {
+		t.Errorf("annotation should override the default, got %+v", got)
+	}
+	if got := sc.config("C", annotations["C"].Cache); got.TTL != time.Second {
+		t.Errorf("default: got %+v", got)
+	}
+}
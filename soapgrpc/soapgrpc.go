@@ -0,0 +1,255 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package soapgrpc serves gRPC services by calling SOAP backends - the reverse of soapproxy.
+//
+// The request message is encoded into a SOAP envelope with the same naming rules
+// protoc-gen-wsdl uses (so the WSDL generated from the .proto describes the call),
+// the response body is decoded into the response message,
+// and the SOAP faults are returned as gRPC status errors.
+package soapgrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	soapproxy "github.com/UNO-SOFT/soap-proxy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Backend calls the SOAP endpoint for the methods of proto services.
+type Backend struct {
+	// HTTPClient is used for the calls, http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// Logger is slog.Default() if nil.
+	Logger *slog.Logger
+	// CustomizeRequest is called on each request, before sending it.
+	// The request's context is the gRPC call's, with its incoming metadata.
+	CustomizeRequest func(*http.Request)
+	// SOAPHeader returns the SOAP header for the action.
+	SOAPHeader func(ctx context.Context, action string) (string, error)
+	// URL of the SOAP endpoint.
+	URL string
+	// TargetNS is the prefix of the SOAPAction,
+	// protoc-gen-wsdl's http://<proto file>/<service>/ if empty.
+	TargetNS string
+	// TypesNS is the namespace of the elements,
+	// protoc-gen-wsdl's http://<proto file>/<service>_types/ if empty.
+	TypesNS string
+}
+
+// Register the service on s, serving its methods by b.
+func (b *Backend) Register(s grpc.ServiceRegistrar, sd protoreflect.ServiceDescriptor) {
+	s.RegisterService(b.ServiceDesc(sd), b)
+}
+
+// ServiceDesc returns the description of the service, serving its methods by b.
+//
+// Client-streaming methods are not supported, server-streaming ones send one response.
+func (b *Backend) ServiceDesc(sd protoreflect.ServiceDescriptor) *grpc.ServiceDesc {
+	desc := grpc.ServiceDesc{
+		ServiceName: string(sd.FullName()),
+		HandlerType: (*any)(nil),
+		Metadata:    sd.ParentFile().Path(),
+	}
+	methods := sd.Methods()
+	for i := range methods.Len() {
+		md := methods.Get(i)
+		switch {
+		case md.IsStreamingClient():
+			continue
+		case md.IsStreamingServer():
+			desc.Streams = append(desc.Streams, grpc.StreamDesc{
+				StreamName:    string(md.Name()),
+				ServerStreams: true,
+				Handler: func(_ any, stream grpc.ServerStream) error {
+					in := dynamicpb.NewMessage(md.Input())
+					if err := stream.RecvMsg(in); err != nil {
+						return err
+					}
+					out, err := b.Call(stream.Context(), md, in)
+					if err != nil {
+						return err
+					}
+					return stream.SendMsg(out)
+				},
+			})
+		default:
+			desc.Methods = append(desc.Methods, grpc.MethodDesc{
+				MethodName: string(md.Name()),
+				Handler: func(_ any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+					in := dynamicpb.NewMessage(md.Input())
+					if err := dec(in); err != nil {
+						return nil, err
+					}
+					if interceptor == nil {
+						return b.Call(ctx, md, in)
+					}
+					info := &grpc.UnaryServerInfo{Server: b,
+						FullMethod: "/" + string(sd.FullName()) + "/" + string(md.Name()),
+					}
+					return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+						return b.Call(ctx, md, req.(proto.Message))
+					})
+				},
+			})
+		}
+	}
+	return &desc
+}
+
+// Action returns the SOAPAction of the method.
+func (b *Backend) Action(md protoreflect.MethodDescriptor) string {
+	targetNS := b.TargetNS
+	if targetNS == "" {
+		sd := md.Parent().(protoreflect.ServiceDescriptor)
+		targetNS = "http://" + sd.ParentFile().Path() + "/" + string(sd.Name()) + "/"
+	}
+	return targetNS + string(md.Name())
+}
+
+func (b *Backend) typesNS(md protoreflect.MethodDescriptor) string {
+	if b.TypesNS != "" {
+		return b.TypesNS
+	}
+	sd := md.Parent().(protoreflect.ServiceDescriptor)
+	return "http://" + sd.ParentFile().Path() + "/" + string(sd.Name()) + "_types/"
+}
+
+// Call the SOAP endpoint with the input message of the method, returning the output message.
+func (b *Backend) Call(ctx context.Context, md protoreflect.MethodDescriptor, in proto.Message) (proto.Message, error) {
+	action := b.Action(md)
+	ns := b.typesNS(md)
+	var buf bytes.Buffer
+	if err := encodeMessage(&buf, xml.Name{Space: ns, Local: ElementName(md.Input())}, in.ProtoReflect()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "encode %s: %v", md.Input().FullName(), err)
+	}
+	var soapHeader string
+	if b.SOAPHeader != nil {
+		var err error
+		if soapHeader, err = b.SOAPHeader(ctx, action); err != nil {
+			return nil, err
+		}
+	}
+	logger := b.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	var statusCode int
+	customizeResponse := func(resp *http.Response) { statusCode = resp.StatusCode }
+	out := dynamicpb.NewMessage(md.Output())
+	resp := xmlMessage{m: out, raw: isRawXML(md.Input(), "p_raw_xml") && isRawXML(md.Output(), "ret")}
+	err := soapproxy.SOAPCallWithHeaderClient(ctx, b.HTTPClient, b.URL,
+		b.CustomizeRequest, customizeResponse,
+		action, soapHeader, buf.String(), &resp, logger)
+	if err != nil {
+		return nil, statusError(statusCode, err)
+	}
+	return out, nil
+}
+
+// statusError converts the error of the call (with the HTTP status code) into a gRPC status.
+func statusError(httpStatus int, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	var f *soapproxy.FaultError
+	if !errors.As(err, &f) {
+		var ne net.Error
+		if httpStatus == 0 && errors.As(err, &ne) {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		if code := httpCode(httpStatus); code != codes.Unknown {
+			return status.Error(code, err.Error())
+		}
+		return status.Error(codes.Internal, err.Error())
+	}
+	code := httpCode(f.StatusCode)
+	if code == codes.Unknown {
+		switch f.Code[strings.LastIndexByte(f.Code, ':')+1:] {
+		case "Client", "Sender":
+			code = codes.InvalidArgument
+		case "VersionMismatch", "MustUnderstand":
+			code = codes.FailedPrecondition
+		default:
+			code = codes.Internal
+		}
+	}
+	return status.Error(code, f.String)
+}
+
+// httpCode returns the gRPC code of the HTTP status, codes.Unknown if there's no specific one.
+func httpCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusFailedDependency:
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	return codes.Unknown
+}
+
+// ElementName returns the name of the element of the message, as protoc-gen-wsdl names it.
+func ElementName(md protoreflect.MessageDescriptor) string {
+	s := string(md.FullName())
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		return s
+	}
+	s = CamelCase(s[:i]) + "_" + s[i+1:]
+	i = strings.IndexByte(s, '_')
+	if strings.HasPrefix(s[i+1:], s[:i+1]) {
+		s = s[i+1:]
+	}
+	return s
+}
+
+// isRawXML reports whether the message has only one string field, named name:
+// protoc-gen-wsdl declares such messages as xs:any.
+func isRawXML(md protoreflect.MessageDescriptor, name protoreflect.Name) bool {
+	fields := md.Fields()
+	return fields.Len() == 1 && fields.Get(0).Name() == name && fields.Get(0).Kind() == protoreflect.StringKind
+}
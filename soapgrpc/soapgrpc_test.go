@@ -0,0 +1,188 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapgrpc_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/soap-proxy/soapgrpc"
+	"github.com/UNO-SOFT/zlog/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func calcService(t *testing.T) protoreflect.ServiceDescriptor {
+	t.Helper()
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string, repeated bool) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(num), Type: typ.Enum(), Label: label.Enum()}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	const (
+		sint32 = descriptorpb.FieldDescriptorProto_TYPE_SINT32
+		msg    = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+		str    = descriptorpb.FieldDescriptorProto_TYPE_STRING
+	)
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name: proto.String("calc.proto"), Package: proto.String("calc"), Syntax: proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Item"), Field: []*descriptorpb.FieldDescriptorProto{field("item_name", 1, str, "", false)}},
+			{Name: proto.String("Divide_Input"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("p_a", 1, sint32, "", false), field("p_b", 2, sint32, "", false),
+				field("p_at", 3, msg, ".google.protobuf.Timestamp", false),
+				field("p_items", 4, msg, ".calc.Item", true),
+				field("p_secret_hidden", 5, str, "", false),
+			}},
+			{Name: proto.String("Divide_Output"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("p_quotient", 1, sint32, "", false), field("p_remainder", 2, sint32, "", false),
+				field("p_items", 3, msg, ".calc.Item", true),
+				field("p_at", 4, msg, ".google.protobuf.Timestamp", false),
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{Name: proto.String("Calc"),
+			Method: []*descriptorpb.MethodDescriptorProto{{Name: proto.String("Divide"),
+				InputType: proto.String(".calc.Divide_Input"), OutputType: proto.String(".calc.Divide_Output"),
+			}},
+		}},
+	}
+	_ = timestamppb.Now()
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd.Services().Get(0)
+}
+
+func TestBackend(t *testing.T) {
+	sd := calcService(t)
+	const env = `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body := string(b)
+		if got := r.Header.Get("SOAPAction"); got != "http://calc.proto/Calc/Divide" {
+			t.Errorf("got SOAPAction %q", got)
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		switch {
+		case strings.Contains(body, "<PB>100</PB>"):
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, env+`<soapenv:Fault><faultcode>soapenv:Client</faultcode><faultstring>division by zero</faultstring></soapenv:Fault></soapenv:Body></soapenv:Envelope>`)
+		case strings.Contains(body, "<PB>-1</PB>"):
+			io.WriteString(w, env+`<soapenv:Fault><faultcode>soapenv:Server</faultcode><faultstring>oops</faultstring></soapenv:Fault></soapenv:Body></soapenv:Envelope>`)
+		case strings.Contains(body, "<PB>-2</PB>"):
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			const want = `<Calc_Divide_Input xmlns="http://calc.proto/Calc_types/"><PA>7</PA><PB>2</PB><PAt>2026-10-18T12:00:00Z</PAt><PItems><ItemName>a&amp;b</ItemName></PItems><PItems><ItemName>c</ItemName></PItems></Calc_Divide_Input>`
+			if !strings.Contains(body, want) {
+				t.Errorf("got %s, wanted %s", body, want)
+			}
+			io.WriteString(w, env+`<Calc_Divide_Output xmlns="http://calc.proto/Calc_types/">
+<PQuotient>3</PQuotient><PRemainder>1</PRemainder><PUnknown>x</PUnknown>
+<PItems><ItemName>x</ItemName></PItems><PItems><ItemName>y</ItemName></PItems>
+<PAt>2026-10-18</PAt>
+</Calc_Divide_Output></soapenv:Body></soapenv:Envelope>`)
+		}
+	}))
+	defer srv.Close()
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	(&soapgrpc.Backend{URL: srv.URL, Logger: zlog.NewT(t).SLog()}).Register(gs, sd)
+	go gs.Serve(lis)
+	defer gs.Stop()
+	cc, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	md := sd.Methods().Get(0)
+	newInput := func(b int32) *dynamicpb.Message {
+		in := dynamicpb.NewMessage(md.Input())
+		fields := md.Input().Fields()
+		in.Set(fields.ByName("p_a"), protoreflect.ValueOfInt32(7))
+		in.Set(fields.ByName("p_b"), protoreflect.ValueOfInt32(b))
+		in.Set(fields.ByName("p_at"), protoreflect.ValueOfMessage(timestamppb.New(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)).ProtoReflect()))
+		in.Set(fields.ByName("p_secret_hidden"), protoreflect.ValueOfString("secret"))
+		items := in.Mutable(fields.ByName("p_items")).List()
+		for _, nm := range []string{"a&b", "c"} {
+			item := items.NewElement()
+			item.Message().Set(item.Message().Descriptor().Fields().Get(0), protoreflect.ValueOfString(nm))
+			items.Append(item)
+		}
+		return in
+	}
+	ctx := context.Background()
+	out := dynamicpb.NewMessage(md.Output())
+	if err = cc.Invoke(ctx, "/calc.Calc/Divide", newInput(2), out); err != nil {
+		t.Fatal(err)
+	}
+	fields := md.Output().Fields()
+	if q, r := out.Get(fields.ByName("p_quotient")).Int(), out.Get(fields.ByName("p_remainder")).Int(); q != 3 || r != 1 {
+		t.Errorf("got %d, %d", q, r)
+	}
+	if n := out.Get(fields.ByName("p_items")).List().Len(); n != 2 {
+		t.Errorf("got %d items", n)
+	}
+	if at := out.Get(fields.ByName("p_at")).Message(); at.Get(at.Descriptor().Fields().ByName("seconds")).Int() != time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC).Unix() {
+		t.Errorf("got at %v", at)
+	}
+
+	for b, want := range map[int32]codes.Code{100: codes.InvalidArgument, -1: codes.Internal, -2: codes.Unavailable} {
+		err := cc.Invoke(ctx, "/calc.Calc/Divide", newInput(b), dynamicpb.NewMessage(md.Output()))
+		if got := status.Code(err); got != want {
+			t.Errorf("%d: got %v, wanted %v", b, err, want)
+		}
+	}
+}
+
+func TestElementName(t *testing.T) {
+	sd := calcService(t)
+	md := sd.Methods().Get(0)
+	if got := soapgrpc.ElementName(md.Input()); got != "Calc_Divide_Input" {
+		t.Errorf("got %q", got)
+	}
+	if got := soapgrpc.CamelCase("p_hiba_kod"); got != "PHibaKod" {
+		t.Errorf("got %q", got)
+	}
+}
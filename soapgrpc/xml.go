@@ -0,0 +1,337 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapgrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const timestampName = protoreflect.FullName("google.protobuf.Timestamp")
+
+// isHidden reports whether the field is left out of the WSDL by protoc-gen-wsdl.
+func isHidden(fd protoreflect.FieldDescriptor) bool {
+	return strings.HasSuffix(string(fd.Name()), "_hidden")
+}
+
+// encodeMessage writes m as the name element, with the fields as protoc-gen-wsdl declares them.
+// Unpopulated fields (with proto3 semantics, zero values, too) are left out.
+func encodeMessage(buf *bytes.Buffer, name xml.Name, m protoreflect.Message) error {
+	enc := xml.NewEncoder(buf)
+	if fields := m.Descriptor().Fields(); name.Space != "" && isRawXML(m.Descriptor(), "p_raw_xml") {
+		// xs:any
+		if err := enc.EncodeToken(xml.StartElement{Name: name}); err != nil {
+			return err
+		}
+		if err := enc.Flush(); err != nil {
+			return err
+		}
+		buf.WriteString(m.Get(fields.Get(0)).String())
+		if err := enc.EncodeToken(xml.EndElement{Name: name}); err != nil {
+			return err
+		}
+		return enc.Flush()
+	}
+	if err := encodeFields(enc, name, m); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+func encodeFields(enc *xml.Encoder, name xml.Name, m protoreflect.Message) error {
+	if err := enc.EncodeToken(xml.StartElement{Name: name}); err != nil {
+		return err
+	}
+	fields := m.Descriptor().Fields()
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		if isHidden(fd) || !m.Has(fd) {
+			continue
+		}
+		// the namespace is inherited
+		fName := xml.Name{Local: CamelCase(string(fd.Name()))}
+		v := m.Get(fd)
+		if !fd.IsList() {
+			if err := encodeValue(enc, fName, fd, v); err != nil {
+				return err
+			}
+			continue
+		}
+		list := v.List()
+		for j := range list.Len() {
+			if err := encodeValue(enc, fName, fd, list.Get(j)); err != nil {
+				return err
+			}
+		}
+	}
+	return enc.EncodeToken(xml.EndElement{Name: name})
+}
+
+func encodeValue(enc *xml.Encoder, name xml.Name, fd protoreflect.FieldDescriptor, v protoreflect.Value) error {
+	var s string
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if fd.Message().FullName() != timestampName {
+			return encodeFields(enc, name, v.Message())
+		}
+		ts := v.Message()
+		flds := ts.Descriptor().Fields()
+		s = time.Unix(ts.Get(flds.ByName("seconds")).Int(), ts.Get(flds.ByName("nanos")).Int()).
+			UTC().Format(time.RFC3339Nano)
+	case protoreflect.BoolKind:
+		s = strconv.FormatBool(v.Bool())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		s = strconv.FormatInt(v.Int(), 10)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		s = strconv.FormatUint(v.Uint(), 10)
+	case protoreflect.FloatKind:
+		s = strconv.FormatFloat(v.Float(), 'g', -1, 32)
+	case protoreflect.DoubleKind:
+		s = strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case protoreflect.BytesKind:
+		s = base64.StdEncoding.EncodeToString(v.Bytes())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			s = string(ev.Name())
+		} else {
+			s = strconv.Itoa(int(v.Enum()))
+		}
+	default:
+		s = v.String()
+	}
+	return enc.EncodeElement(s, xml.StartElement{Name: name})
+}
+
+// xmlMessage decodes the response element into m.
+type xmlMessage struct {
+	m protoreflect.Message
+	// raw is set for the messages declared as xs:any: the inner XML is the one string field.
+	raw bool
+}
+
+func (xm *xmlMessage) UnmarshalXML(dec *xml.Decoder, st xml.StartElement) error {
+	if xm.raw {
+		var inner struct {
+			XML string `xml:",innerxml"`
+		}
+		if err := dec.DecodeElement(&inner, &st); err != nil {
+			return err
+		}
+		xm.m.Set(xm.m.Descriptor().Fields().Get(0), protoreflect.ValueOfString(strings.TrimSpace(inner.XML)))
+		return nil
+	}
+	return decodeFields(dec, xm.m)
+}
+
+// decodeFields decodes the child elements into the fields of m, till the end of the element.
+func decodeFields(dec *xml.Decoder, m protoreflect.Message) error {
+	byName := fieldsByElement(m.Descriptor())
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var st xml.StartElement
+		switch x := tok.(type) {
+		case xml.EndElement:
+			return nil
+		case xml.StartElement:
+			st = x
+		default:
+			continue
+		}
+		fd := byName[st.Name.Local]
+		if fd == nil || isNil(st) {
+			if err = dec.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+		var v protoreflect.Value
+		if fd.Kind() == protoreflect.MessageKind {
+			var sub protoreflect.Message
+			if fd.IsList() {
+				sub = m.Mutable(fd).List().NewElement().Message()
+			} else {
+				sub = m.NewField(fd).Message()
+			}
+			if fd.Message().FullName() == timestampName {
+				var s string
+				if err = dec.DecodeElement(&s, &st); err != nil {
+					return err
+				}
+				if s = strings.TrimSpace(s); s == "" {
+					continue
+				}
+				err = setTimestamp(sub, s)
+			} else {
+				err = decodeFields(dec, sub)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", fd.FullName(), err)
+			}
+			v = protoreflect.ValueOfMessage(sub)
+		} else {
+			var s string
+			if err = dec.DecodeElement(&s, &st); err != nil {
+				return err
+			}
+			if s = strings.TrimSpace(s); s == "" && fd.Kind() != protoreflect.StringKind {
+				continue
+			}
+			if v, err = parseValue(fd, s); err != nil {
+				return fmt.Errorf("%s: %w", fd.FullName(), err)
+			}
+		}
+		if fd.IsList() {
+			m.Mutable(fd).List().Append(v)
+		} else {
+			m.Set(fd, v)
+		}
+	}
+}
+
+func isNil(st xml.StartElement) bool {
+	for _, a := range st.Attr {
+		if a.Name.Local == "nil" && a.Value == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// setTimestamp sets the google.protobuf.Timestamp ts to the xs:dateTime (or xs:date) s.
+func setTimestamp(ts protoreflect.Message, s string) error {
+	var t time.Time
+	var err error
+	for _, layout := range timeLayouts {
+		if t, err = time.Parse(layout, s); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fields := ts.Descriptor().Fields()
+	ts.Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(t.Unix()))
+	ts.Set(fields.ByName("nanos"), protoreflect.ValueOfInt32(int32(t.Nanosecond())))
+	return nil
+}
+
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02Z07:00", "2006-01-02"}
+
+func parseValue(fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(s)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		i, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(i)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		i, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(i), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		i, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(i)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		i, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(i), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(s, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(s, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.BytesKind:
+		b, err := base64.StdEncoding.DecodeString(s)
+		return protoreflect.ValueOfBytes(b), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(s)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		i, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(i)), err
+	}
+	return protoreflect.Value{}, fmt.Errorf("unsupported kind %s", fd.Kind())
+}
+
+var elementFields sync.Map // protoreflect.FullName -> map[string]protoreflect.FieldDescriptor
+
+// fieldsByElement returns the fields of the message by their element names.
+func fieldsByElement(md protoreflect.MessageDescriptor) map[string]protoreflect.FieldDescriptor {
+	if m, ok := elementFields.Load(md.FullName()); ok {
+		return m.(map[string]protoreflect.FieldDescriptor)
+	}
+	fields := md.Fields()
+	m := make(map[string]protoreflect.FieldDescriptor, fields.Len())
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		m[CamelCase(string(fd.Name()))] = fd
+	}
+	elementFields.Store(md.FullName(), m)
+	return m
+}
+
+var digitUnder = strings.NewReplacer(
+	"_0", "__0",
+	"_1", "__1",
+	"_2", "__2",
+	"_3", "__3",
+	"_4", "__4",
+	"_5", "__5",
+	"_6", "__6",
+	"_7", "__7",
+	"_8", "__8",
+	"_9", "__9",
+)
+
+// CamelCase returns the element name of the field name, as protoc-gen-wsdl names it.
+func CamelCase(text string) string {
+	if text == "" {
+		return text
+	}
+	text = digitUnder.Replace(text)
+	var last rune
+	return strings.Map(func(r rune) rune {
+		defer func() { last = r }()
+		if r == '_' {
+			if last != '_' {
+				return -1
+			}
+			return '_'
+		}
+		if last == 0 || last == '_' || '0' <= last && last <= '9' {
+			return unicode.ToUpper(r)
+		}
+		return unicode.ToLower(r)
+	},
+		text,
+	)
+}
@@ -0,0 +1,461 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package soapmock provides a SOAP test server, for testing the consumers of SOAP APIs
+// (such as soapproxy.SOAPCall).
+//
+// The stubs are matched by SOAPAction (or operation name) and path predicates on the request,
+// and respond with a templated body or a fault, optionally delayed or failing on the HTTP level.
+// The calls are recorded for assertions.
+//
+//	srv := soapmock.New(t, wsdl)
+//	srv.On("Login").Where("//PLoginNev", "bob").Reply(`<Login_Output><Name>{{xml (.Value "//PLoginNev")}}</Name></Login_Output>`)
+//	srv.On("Login").Fault("soapenv:Client", "bad user", "")
+//	err := soapproxy.SOAPCall(ctx, srv.URL, "Login", req, &resp, logger)
+package soapmock
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	soapproxy "github.com/UNO-SOFT/soap-proxy"
+)
+
+// Server is a SOAP test server.
+type Server struct {
+	*httptest.Server
+	t testing.TB
+	// operations maps the soapActions and the operation names to the operation names of the WSDL.
+	operations map[string]string
+	wsdl       string
+	stubs      []*Stub
+	calls      []Call
+	mu         sync.Mutex
+}
+
+// Call is a recorded call.
+type Call struct {
+	Time   time.Time
+	Header http.Header
+	// Action is the SOAPAction header, Operation is the matched operation name.
+	Action, Operation string
+	Body              string
+	// Stub is the index of the matched stub, -1 if none matched.
+	Stub int
+}
+
+// New starts a new Server, closed at the end of the test.
+//
+// If wsdl is not empty, it is served on GET requests, and the stubs are checked against its operations.
+func New(t testing.TB, wsdl string) *Server {
+	t.Helper()
+	s := &Server{t: t, wsdl: wsdl}
+	if wsdl != "" {
+		var err error
+		if s.operations, err = parseOperations(wsdl); err != nil {
+			t.Fatalf("parse WSDL: %+v", err)
+		}
+	}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// parseOperations returns the operations of the WSDL, by name and soapAction.
+func parseOperations(wsdl string) (map[string]string, error) {
+	ops := make(map[string]string)
+	dec := xml.NewDecoder(strings.NewReader(wsdl))
+	var operation string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return ops, nil
+			}
+			return ops, err
+		}
+		st, ok := tok.(xml.StartElement)
+		if !ok || st.Name.Local != "operation" {
+			continue
+		}
+		for _, a := range st.Attr {
+			switch a.Name.Local {
+			case "name":
+				operation = a.Value
+				ops[operation] = operation
+			case "soapAction":
+				if operation != "" {
+					ops[a.Value] = operation
+				}
+			}
+		}
+	}
+}
+
+// On returns a new Stub for the action: either the SOAPAction or the operation name.
+// The stubs are tried in the order of their creation.
+func (s *Server) On(action string) *Stub {
+	s.t.Helper()
+	if s.operations != nil {
+		if _, ok := s.operations[action]; !ok {
+			s.t.Fatalf("unknown operation %q", action)
+		}
+	}
+	st := &Stub{action: action, server: s}
+	s.mu.Lock()
+	s.stubs = append(s.stubs, st)
+	s.mu.Unlock()
+	return st
+}
+
+// Calls returns the recorded calls.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.calls)
+}
+
+// Reset the stubs and the recorded calls.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	s.stubs, s.calls = nil, nil
+	s.mu.Unlock()
+}
+
+// Stub is a canned response. Its methods configure it, and return it for chaining;
+// they are safe to call while the server is serving.
+type Stub struct {
+	server     *Server
+	tmpl       *template.Template
+	fault      *soapproxy.SOAPFault
+	action     string
+	preds      []predicate
+	delay      time.Duration
+	retryAfter time.Duration
+	status     int
+	times      int
+	used       int
+	closeConn  bool
+}
+
+type predicate struct {
+	match func(string) bool
+	path  string
+}
+
+// Where adds a predicate: the value at path must be value.
+//
+// The path is a slash-separated list of the local names of the elements,
+// starting from the element in the Body (e.g. "Login/PLoginNev");
+// starting with "/" means from the Envelope ("/Envelope/Header/AuthToken"),
+// and starting with "//" means at any depth ("//PLoginNev"). "*" matches any element.
+func (st *Stub) Where(path, value string) *Stub {
+	return st.WhereFunc(path, func(s string) bool { return s == value })
+}
+
+// WhereFunc adds a predicate: any value at path must satisfy match.
+func (st *Stub) WhereFunc(path string, match func(string) bool) *Stub {
+	return st.set(func() { st.preds = append(st.preds, predicate{path: path, match: match}) })
+}
+
+// set the stub's fields under the server's lock.
+func (st *Stub) set(f func()) *Stub {
+	st.server.mu.Lock()
+	defer st.server.mu.Unlock()
+	f()
+	return st
+}
+
+// Reply with the template of the Body content.
+// The template is executed with the *Request, and the "xml" function escapes its argument.
+func (st *Stub) Reply(bodyTemplate string) *Stub {
+	st.server.t.Helper()
+	tmpl, err := template.New(st.action).Funcs(templateFuncs).Parse(bodyTemplate)
+	if err != nil {
+		st.server.t.Fatalf("parse template: %+v", err)
+	}
+	return st.set(func() { st.tmpl = tmpl })
+}
+
+var templateFuncs = template.FuncMap{"xml": func(s string) string {
+	var buf strings.Builder
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}}
+
+// Fault replies with a SOAP fault.
+func (st *Stub) Fault(code, message, detail string) *Stub {
+	fault := &soapproxy.SOAPFault{Code: code, String: message, Detail: detail}
+	return st.set(func() { st.fault = fault })
+}
+
+// Delay the response.
+func (st *Stub) Delay(d time.Duration) *Stub {
+	return st.set(func() { st.delay = d })
+}
+
+// HTTPError replies with the given HTTP status code and no SOAP body.
+func (st *Stub) HTTPError(status int) *Stub {
+	return st.set(func() { st.status = status })
+}
+
+// RetryAfter sets the Retry-After header (in whole seconds, rounded up) of the
+// HTTPError and Fault replies, to simulate throttling.
+func (st *Stub) RetryAfter(d time.Duration) *Stub {
+	return st.set(func() { st.retryAfter = d })
+}
+
+// CloseConnection closes the connection without replying.
+func (st *Stub) CloseConnection() *Stub {
+	return st.set(func() { st.closeConn = true })
+}
+
+// Times limits the number of matches of the stub, after which the next stubs are tried.
+func (st *Stub) Times(n int) *Stub {
+	return st.set(func() { st.times = n })
+}
+
+// Request is the data of the response templates.
+type Request struct {
+	root   *node
+	Header http.Header
+	Action string
+	Body   string
+}
+
+// Value returns the first value at path (see Stub.Where).
+func (r *Request) Value(path string) string {
+	if vv := r.Values(path); len(vv) != 0 {
+		return vv[0]
+	}
+	return ""
+}
+
+// Values returns the values at path (see Stub.Where).
+func (r *Request) Values(path string) []string {
+	nodes := r.root.find(path)
+	values := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		values = append(values, n.text)
+	}
+	return values
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && s.wsdl != "" {
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		io.WriteString(w, s.wsdl)
+		return
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	root, err := parseTree(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &Request{root: root, Header: r.Header.Clone(), Action: strings.Trim(r.Header.Get("SOAPAction"), `"`), Body: string(b)}
+	operation := s.operations[req.Action]
+	if operation == "" {
+		if bodies := root.find("*"); len(bodies) != 0 {
+			operation = bodies[0].name
+		}
+	}
+
+	s.mu.Lock()
+	call := Call{Time: time.Now(), Header: req.Header, Action: req.Action, Operation: operation, Body: req.Body, Stub: -1}
+	var stub *Stub
+	for i, st := range s.stubs {
+		if st.matches(req, operation) {
+			st.used++
+			// a copy, as the stub may be reconfigured while replying
+			cp := *st
+			stub, call.Stub = &cp, i
+			break
+		}
+	}
+	s.calls = append(s.calls, call)
+	s.mu.Unlock()
+
+	if stub == nil {
+		writeFault(w, &soapproxy.SOAPFault{Code: "soapenv:Server", String: fmt.Sprintf("no stub for %q (%s)", req.Action, operation)})
+		return
+	}
+	if stub.delay > 0 {
+		select {
+		case <-time.After(stub.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if stub.closeConn {
+		if conn, _, err := http.NewResponseController(w).Hijack(); err == nil {
+			conn.Close()
+			return
+		}
+		panic(http.ErrAbortHandler)
+	}
+	if stub.retryAfter > 0 && (stub.status != 0 || stub.fault != nil) {
+		w.Header().Set("Retry-After", strconv.Itoa(int((stub.retryAfter+time.Second-1)/time.Second)))
+	}
+	if stub.status != 0 {
+		w.WriteHeader(stub.status)
+		return
+	}
+	if stub.fault != nil {
+		writeFault(w, stub.fault)
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString(soapproxy.SOAPHeader + soapproxy.SOAPBody)
+	if stub.tmpl != nil {
+		if err := stub.tmpl.Execute(&buf, req); err != nil {
+			writeFault(w, &soapproxy.SOAPFault{Code: "soapenv:Server", String: err.Error()})
+			return
+		}
+	}
+	buf.WriteString(soapproxy.SOAPFooter)
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// matches reports whether the stub matches the request. Must be called with s.mu held.
+func (st *Stub) matches(req *Request, operation string) bool {
+	if st.times > 0 && st.used >= st.times {
+		return false
+	}
+	if st.action != req.Action && st.action != operation {
+		return false
+	}
+	for _, p := range st.preds {
+		values := req.Values(p.path)
+		if len(values) == 0 || !slices.ContainsFunc(values, p.match) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeFault(w http.ResponseWriter, fault *soapproxy.SOAPFault) {
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	var buf bytes.Buffer
+	buf.WriteString(soapproxy.SOAPHeader + soapproxy.SOAPBody)
+	_ = xml.NewEncoder(&buf).Encode(fault)
+	buf.WriteString(soapproxy.SOAPFooter)
+	w.Write(buf.Bytes())
+}
+
+// node is an element of the request.
+type node struct {
+	parent   *node
+	name     string
+	text     string
+	children []*node
+}
+
+func parseTree(b []byte) (*node, error) {
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	doc := &node{}
+	cur := doc
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		switch x := tok.(type) {
+		case xml.StartElement:
+			n := &node{parent: cur, name: x.Name.Local}
+			cur.children = append(cur.children, n)
+			cur = n
+		case xml.EndElement:
+			cur.text = strings.TrimSpace(cur.text)
+			cur = cur.parent
+		case xml.CharData:
+			cur.text += string(x)
+		}
+	}
+	return doc, nil
+}
+
+// find the nodes at path - see Stub.Where.
+func (doc *node) find(path string) []*node {
+	var nodes []*node
+	switch {
+	case strings.HasPrefix(path, "//"):
+		path = path[2:]
+		first, rest, _ := strings.Cut(path, "/")
+		doc.walk(func(n *node) {
+			if n.name == first || first == "*" {
+				nodes = append(nodes, n)
+			}
+		})
+		return findChildren(nodes, rest)
+	case strings.HasPrefix(path, "/"):
+		return findChildren([]*node{doc}, path[1:])
+	}
+	// below the Body
+	for _, env := range doc.children {
+		for _, body := range env.children {
+			if body.name == "Body" {
+				nodes = append(nodes, body)
+			}
+		}
+	}
+	return findChildren(nodes, path)
+}
+
+func findChildren(nodes []*node, path string) []*node {
+	if path == "" {
+		return nodes
+	}
+	for seg := range strings.SplitSeq(path, "/") {
+		var next []*node
+		for _, n := range nodes {
+			for _, c := range n.children {
+				if c.name == seg || seg == "*" {
+					next = append(next, c)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+func (n *node) walk(f func(*node)) {
+	for _, c := range n.children {
+		f(c)
+		c.walk(f)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapmock_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	soapproxy "github.com/UNO-SOFT/soap-proxy"
+	"github.com/UNO-SOFT/soap-proxy/soapmock"
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+func TestServer(t *testing.T) {
+	wsdl, err := os.ReadFile("../testdata/withAny.wsdl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := soapmock.New(t, string(wsdl))
+	srv.On("DbWebGdpr_Kereses").Where("DbWebGdpr_Kereses_Input/PEmail", "a@b").
+		Reply(`<Out><Email>{{xml (.Value "//PEmail")}}</Email><Action>{{.Action}}</Action></Out>`)
+	srv.On("DbWebGdpr_Kereses").WhereFunc("//PEmail", func(s string) bool { return strings.HasSuffix(s, "@x") }).
+		Fault("soapenv:Client", "no such email", "")
+	srv.On("DbWebGdpr_Keres").CloseConnection().Times(1)
+	srv.On("http://unosoft.hu/ws/bruno/pb/gdpr/gdpr.proto/Gdpr/DbWebGdpr_Keres").Delay(10 * time.Millisecond).Reply(`<Out><Email>ok</Email></Out>`)
+
+	ctx := context.Background()
+	logger := zlog.NewT(t).SLog()
+	const kereses = "http://unosoft.hu/ws/bruno/pb/gdpr/gdpr.proto/Gdpr/DbWebGdpr_Kereses"
+	var resp struct{ Email, Action string }
+	if err := soapproxy.SOAPCall(ctx, srv.URL, kereses,
+		`<DbWebGdpr_Kereses_Input><PEmail>a@b</PEmail></DbWebGdpr_Kereses_Input>`, &resp, logger,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Email != "a@b" || resp.Action != kereses {
+		t.Errorf("got %+v", resp)
+	}
+
+	err = soapproxy.SOAPCall(ctx, srv.URL, kereses,
+		`<DbWebGdpr_Kereses_Input><PEmail>c@x</PEmail></DbWebGdpr_Kereses_Input>`, &resp, logger)
+	if err == nil || !strings.Contains(err.Error(), "no such email") {
+		t.Errorf("wanted fault, got %+v", err)
+	}
+
+	// the first call fails, the retry (of the idempotent call) succeeds
+	resp.Email = ""
+	if err := soapproxy.SOAPCall(soapproxy.WithIdempotent(ctx, true), srv.URL, "http://unosoft.hu/ws/bruno/pb/gdpr/gdpr.proto/Gdpr/DbWebGdpr_Keres",
+		`<DbWebGdpr_Keres_Input/>`, &resp, logger,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Email != "ok" {
+		t.Errorf("got %+v", resp)
+	}
+
+	calls := srv.Calls()
+	if len(calls) != 4 {
+		t.Fatalf("got %d calls", len(calls))
+	}
+	for i, want := range []struct {
+		Operation string
+		Stub      int
+	}{{"DbWebGdpr_Kereses", 0}, {"DbWebGdpr_Kereses", 1}, {"DbWebGdpr_Keres", 2}, {"DbWebGdpr_Keres", 3}} {
+		if calls[i].Operation != want.Operation || calls[i].Stub != want.Stub {
+			t.Errorf("%d. got %+v, wanted %+v", i, calls[i], want)
+		}
+	}
+
+	resp2, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != 200 {
+		t.Errorf("GET WSDL: %s", resp2.Status)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	srv := soapmock.New(t, "")
+	srv.On("Act").HTTPError(http.StatusServiceUnavailable)
+	var resp struct{}
+	err := soapproxy.SOAPCall(context.Background(), srv.URL, "Act", "<Req/>", &resp, zlog.NewT(t).SLog())
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("wanted 503, got %+v", err)
+	}
+	srv.Reset()
+	if err = soapproxy.SOAPCall(context.Background(), srv.URL, "Act", "<Req/>", &resp, zlog.NewT(t).SLog()); err == nil {
+		t.Error("wanted no stub error")
+	}
+	if calls := srv.Calls(); len(calls) != 1 || calls[0].Stub != -1 {
+		t.Errorf("got %+v", calls)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	srv := soapmock.New(t, "")
+	st := srv.On("Act").HTTPError(http.StatusTooManyRequests).RetryAfter(1500 * time.Millisecond)
+	post := func() *http.Response {
+		req, _ := http.NewRequest("POST", srv.URL, strings.NewReader(soapproxy.SOAPHeader+soapproxy.SOAPBody+"<Act/>"+soapproxy.SOAPFooter))
+		req.Header.Set("SOAPAction", "Act")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			return &http.Response{}
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := post(); resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "2" {
+		t.Errorf("got %d Retry-After=%q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// reconfiguring while serving
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 10 {
+			post()
+		}
+	}()
+	for range 10 {
+		st.Delay(time.Millisecond).RetryAfter(time.Second)
+	}
+	wg.Wait()
+}
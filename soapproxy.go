@@ -27,7 +27,6 @@ import (
 	"io"
 	"log"
 	"log/slog"
-	"maps"
 	"net/http"
 	"reflect"
 	"strconv"
@@ -42,6 +41,10 @@ import (
 	"github.com/klauspost/compress/gzhttp"
 	"github.com/tgulacsi/go/iohlp"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
 	"golang.org/x/net/html/charset"
 
 	"google.golang.org/grpc"
@@ -65,6 +68,49 @@ type SOAPHandlerConfig struct {
 	WSDL          string
 	Locations     []string
 	Timeout       time.Duration
+	// MaxTimeout caps the timeouts requested by the clients (in the Request-Timeout header or the TimeoutElement).
+	// If zero, the operation's timeout is the cap, so the clients can only shorten it.
+	MaxTimeout time.Duration
+	// TimeoutElement is the local name of the SOAP Header element holding the requested timeout, if set.
+	TimeoutElement string
+	// MaxSpoolSize limits the (uncompressed) size of the temp files used for merging the parts of a response.
+	// Zero means no limit.
+	//
+	// Exceeding it cancels the call, and answers a fault if nothing has been sent yet,
+	// or aborts the connection otherwise.
+	MaxSpoolSize int64
+
+	// TokenAuth validates the "Authorization: Bearer" JWTs, if set.
+	TokenAuth *TokenValidator `json:"-"`
+	// LegacyAuthFault maps the legacy backends' codes.Unknown "bad username or password" error
+	// to 401 and soapenv:Client fault, as the codes.Unauthenticated and codes.PermissionDenied errors are.
+	LegacyAuthFault bool
+	// Authorizer checks whether the caller may call the operation, if set.
+	Authorizer Authorizer `json:"-"`
+	// RateLimiter limits the calls per operation and caller, if set.
+	RateLimiter *RateLimiter `json:"-"`
+	// Limits on the size and complexity of the requests.
+	Limits XMLLimits
+	// Metrics collects the metrics of the proxied calls, if set.
+	Metrics *Metrics `json:"-"`
+	// TracerProvider for the spans; otel.GetTracerProvider() if nil.
+	TracerProvider trace.TracerProvider `json:"-"`
+	// Propagator extracts the trace context from the HTTP request and injects it into the gRPC metadata.
+	// W3C traceparent and baggage if nil.
+	Propagator propagation.TextMapPropagator `json:"-"`
+	// Audit receives the record of each proxied call, if set.
+	Audit AuditSink `json:"-"`
+	// AuditMaxBody is the maximum size of the request and response envelopes in the audit records,
+	// DefaultAuditMaxBody if zero.
+	AuditMaxBody int
+	// Redactor masks the sensitive data in the logs and the audit records, if set.
+	Redactor *Redactor `json:"-"`
+	// CaptureDir is the directory where the calls are recorded for replaying, if set - see ReplayDir.
+	CaptureDir string
+	// Cache of the responses of the read-only operations, if set.
+	Cache *ServerCache `json:"-"`
+	// Annotations of the operations, overriding the ones in the WSDL - see LoadAnnotations.
+	Annotations map[string]Annotation `json:"annotations,omitempty"`
 }
 
 func (c SOAPHandlerConfig) getLogger(ctx context.Context) *slog.Logger {
@@ -87,8 +133,20 @@ type soapHandler struct {
 	wsdlWithLocations string                `json:"-"`
 }
 
+// NewSOAPHandler returns a new handler for the config, logging its errors (see Validate).
 func NewSOAPHandler(config SOAPHandlerConfig) soapHandler {
-	h := soapHandler{SOAPHandlerConfig: config}
+	h, err := config.New()
+	if err != nil {
+		h.Error("annotations", "error", err)
+	}
+	return h
+}
+
+// New returns a new handler for the config, and the errors of the config (see Validate).
+//
+// The handler is usable even with errors.
+func (c SOAPHandlerConfig) New() (soapHandler, error) {
+	h := soapHandler{SOAPHandlerConfig: c}
 
 	if h.Logger == nil {
 		h.Logger = slog.Default()
@@ -112,64 +170,25 @@ func NewSOAPHandler(config SOAPHandlerConfig) soapHandler {
 	}
 
 	// init annotations
-	h.annotations = make(map[string]Annotation)
-	dec := newXMLDecoder(strings.NewReader(h.WSDL))
-	stack := make([]xml.StartElement, 0, 8)
-	names := make(map[string]struct{})
-	for {
-		tok, err := dec.Token()
-		if err != nil {
-			break
-		}
-		switch x := tok.(type) {
-		case xml.StartElement:
-			if x.Name.Local == "any" && (x.Name.Space == "" || x.Name.Space == "http://www.w3.org/2001/XMLSchema") {
-				if len(stack) >= 3 && stack[len(stack)-1].Name.Local == "sequence" && stack[len(stack)-2].Name.Local == "complexType" && stack[len(stack)-3].Name.Local == "element" {
-					for _, attr := range stack[len(stack)-3].Attr {
-						if attr.Name.Local == "name" {
-							names[attr.Value] = struct{}{}
-						}
-					}
-				}
-			}
-			stack = append(stack, x)
-		case xml.CharData:
-			if len(stack) > 1 && stack[len(stack)-1].Name.Local == "documentation" {
-				x = bytes.TrimSpace(x)
-				if bytes.HasPrefix(x, []byte{'{'}) {
-					m := make(map[string]Annotation)
-					if err = json.NewDecoder(bytes.NewReader(x)).Decode(&m); err != nil {
-						h.Error("parse", "documentation", string(x), "error", err)
-					} else {
-						if h.annotations == nil {
-							h.annotations = m
-						} else {
-							maps.Copy(h.annotations, m)
-						}
-					}
-				}
+	var err error
+	h.annotations, err = h.SOAPHandlerConfig.annotations()
+	var rateLimits map[string]RateLimit
+	for k, a := range h.annotations {
+		if a.RateLimit != nil {
+			if rateLimits == nil {
+				rateLimits = make(map[string]RateLimit)
 			}
-		case xml.EndElement:
-			stack = stack[:len(stack)-1]
+			rateLimits[k[strings.LastIndexByte(k, '/')+1:]] = *a.RateLimit
 		}
 	}
-	for nm := range names {
-		k := strings.TrimSuffix(nm, "_Input")
-		if k != nm {
-			if _, ok := names[k+"_Output"]; ok {
-				a := h.annotations[k]
-				a.Raw = true
-				h.annotations[k] = a
-			}
+	if rateLimits != nil {
+		if h.RateLimiter == nil {
+			h.RateLimiter = NewRateLimiter(RateLimiterConfig{})
 		}
+		h.RateLimiter.addOperations(rateLimits)
 	}
 
-	return h
-}
-
-type Annotation struct {
-	Raw      bool
-	RemoveNS bool
+	return h, err
 }
 
 func (h soapHandler) Input(name string) any {
@@ -185,8 +204,43 @@ func (h soapHandler) Input(name string) any {
 var bufPool = sync.Pool{New: func() any { return bytes.NewBuffer(make([]byte, 0, 1024)) }}
 
 func (h soapHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	gzhttp.GzipHandler(http.HandlerFunc(h.serveHTTP)).ServeHTTP(w, r)
+	ww := &wireWriter{ResponseWriter: w}
+	r = r.WithContext(context.WithValue(r.Context(), wireWriterKey{}, ww))
+	gzhttp.GzipHandler(http.HandlerFunc(h.serveHTTP)).ServeHTTP(ww, r)
+}
+
+type wireWriterKey struct{}
+
+// wireWriter is the http.ResponseWriter below the gzip layer,
+// recording whether anything has been sent to the client (the gzip layer holds back the small responses).
+// After discard is set, everything written into it is dropped.
+type wireWriter struct {
+	http.ResponseWriter
+	sent, discard bool
+}
+
+func (ww *wireWriter) WriteHeader(code int) {
+	if !ww.discard {
+		ww.sent = true
+		ww.ResponseWriter.WriteHeader(code)
+	}
+}
+func (ww *wireWriter) Write(p []byte) (int, error) {
+	if ww.discard {
+		return len(p), nil
+	}
+	ww.sent = true
+	return ww.ResponseWriter.Write(p)
 }
+func (ww *wireWriter) Flush() {
+	if !ww.discard {
+		ww.sent = true
+		http.NewResponseController(ww.ResponseWriter).Flush()
+	}
+}
+
+// Unwrap is for http.ResponseController.
+func (ww *wireWriter) Unwrap() http.ResponseWriter { return ww.ResponseWriter }
 func (h soapHandler) serveHTTP(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	ctx := r.Context()
@@ -205,13 +259,77 @@ func (h soapHandler) serveHTTP(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, body)
 		return
 	}
-	mayFilterEmptyTags(r, logger)
 
-	rI, inp, err := h.DecodeRequest(ctx, r)
+	start := time.Now()
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	rec := &responseRecorder{ResponseWriter: w, abort: abort}
+	w = rec
+	var stats requestStats
+	tracer := h.tracer()
+	ctx = h.propagator().Extract(ctx, propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "SOAP", trace.WithSpanKind(trace.SpanKindServer))
+	defer func() { endServerSpan(span, rec) }()
+	body := &countingReader{ReadCloser: r.Body}
+	r.Body = body
+	h.Limits.limitBody(w, r)
+	var auditReq, auditResp *capBuffer
+	var capt *capture
+	var reqCopies, respCopies []io.Writer
+	if h.Audit != nil {
+		auditReq, auditResp = newCapBuffer(h.auditMaxBody()), newCapBuffer(h.auditMaxBody())
+		reqCopies, respCopies = append(reqCopies, auditReq), append(respCopies, auditResp)
+	}
+	if h.CaptureDir != "" {
+		capt = newCapture(r)
+		reqCopies, respCopies = append(reqCopies, &capt.request), append(respCopies, &capt.response)
+	}
+	if len(reqCopies) != 0 {
+		rec.capture = io.MultiWriter(respCopies...)
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, io.MultiWriter(reqCopies...)), r.Body}
+	}
+	defer func() {
+		stats.RequestBytes = body.n
+		if stats.Aborted = rec.writeErr != nil || r.Context().Err() != nil; stats.Aborted {
+			logger.Warn("client aborted", "action", stats.Operation, "written", rec.written, "error", context.Cause(ctx))
+		}
+		h.Metrics.observeRequest(stats, rec)
+		if h.Audit != nil {
+			h.audit(ctx, r, start, stats, rec, auditReq, auditResp)
+		}
+		if capt != nil {
+			if err := capt.write(h.CaptureDir, rec.status); err != nil {
+				logger.Error("capture", "dir", h.CaptureDir, "error", err)
+			}
+		}
+	}()
+	if h.TokenAuth != nil {
+		var err error
+		if ctx, err = h.TokenAuth.authenticate(ctx, r); err != nil {
+			logger.Warn("authenticate", "error", err)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			soapError(w, authError{err})
+			return
+		}
+	}
+	keepEmptyTags := h.annotation(soapActionName(r.Header.Get("SOAPAction"))).KeepEmptyTags
+	if err := mayFilterEmptyTags(r, logger, h.Limits, h.Redactor, keepEmptyTags); err != nil {
+		logger.Error("FilterEmptyTags", "error", err)
+		soapError(w, err)
+		return
+	}
+
+	dctx, dSpan := tracer.Start(ctx, "decode")
+	rI, inp, err := h.DecodeRequest(dctx, r)
 	r.Body.Close()
+	stats.Decode, stats.decoded = time.Since(start), true
+	endSpan(dSpan, err)
 	if err != nil {
 		logger.Error("decode", "into", fmt.Sprintf("%T", inp), "error", err)
-		if errors.Is(err, errDecode) {
+		if errors.Is(err, errDecode) || errors.Is(err, ErrLimitExceeded) {
 			soapError(w, err)
 		} else {
 			http.Error(w, err.Error(), http.StatusBadRequest)
@@ -219,40 +337,213 @@ func (h soapHandler) serveHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	request := rI.(requestInfo)
+	stats.Operation = request.Action
+	if capt != nil {
+		capt.Action, capt.Input = request.Action, captureMessage(inp)
+	}
+	span.SetName(request.Action)
+	span.SetAttributes(attribute.String("soap.action", request.SOAPAction))
+
+	caller := callerFromRequest(ctx, r, h.TokenAuth.rolesClaim())
+	ctx = context.WithValue(ctx, callerKey{}, caller)
+	if h.Authorizer != nil {
+		if err = h.Authorizer.Authorize(ctx, request.Action, caller); err != nil {
+			logger.Warn("authorize", "action", request.Action, "caller", caller.Name, "method", caller.Method, "error", err)
+			soapError(w, forbiddenError{err})
+			return
+		}
+	}
+	if len(request.Roles) != 0 && !caller.hasAnyRole(request.Roles) {
+		err = fmt.Errorf("%q: %s caller %q: %w", request.Action, caller.Method, caller.Name, ErrForbidden)
+		logger.Warn("authorize", "action", request.Action, "roles", request.Roles, "caller", caller.Name, "error", err)
+		soapError(w, forbiddenError{err})
+		return
+	}
+	if request.Deprecated {
+		logger.Warn("deprecated operation", "action", request.Action, "caller", caller.Name, "method", caller.Method)
+		w.Header().Set("Deprecation", "true")
+	}
+	if h.RateLimiter != nil {
+		release, err := h.RateLimiter.Acquire(request.Action, callerLimitKey(caller, r))
+		if err != nil {
+			var rle *rateLimitError
+			if errors.As(err, &rle) {
+				w.Header().Set("Retry-After", rle.RetryAfter())
+			}
+			logger.Warn("rate limit", "action", request.Action, "caller", caller.Name, "error", err)
+			soapError(w, err)
+			return
+		}
+		defer release()
+	}
 
 	buf := bufPool.Get().(*bytes.Buffer)
 	defer bufPool.Put(buf)
 	buf.Reset()
 	jenc := json.NewEncoder(buf)
 	_ = jenc.Encode(inp)
-	logger.Info("Calling", "soapAction", request.Action, "inp", buf.String())
+	inpJSON := h.Redactor.Value(inp)
+
+	var cacheKey string
+	var cacheBuf *capBuffer
+	var cacheTTL time.Duration
+	// only the callers verified by the proxy itself are served from the cache,
+	// as it bypasses the backend's checks (e.g. of the Basic passwords)
+	if h.Cache != nil && caller.Verified() {
+		var hdr bytes.Buffer
+		oc := h.Cache.config(request.Action, request.Annotation.Cache)
+		// the response's header is encoded from the request's
+		if oc.TTL > 0 && request.EncodeHeader != nil {
+			if err := request.EncodeHeader(ctx, &hdr, nil); err != nil {
+				logger.Warn("EncodeHeader for the cache key", "error", err)
+				oc.TTL = 0
+			}
+		}
+		if oc.TTL > 0 {
+			var scope string
+			if !oc.Shared {
+				scope = callerLimitKey(caller, r)
+			}
+			cacheKey, cacheTTL = h.Cache.key(request.Action, hdr.Bytes(), buf.Bytes(), scope), oc.TTL
+			b, ok := h.Cache.Store.Get(cacheKey)
+			h.Metrics.observeCache(request.Action, ok)
+			if ok {
+				logger.Info("cached", "soapAction", request.Action, "inp", inpJSON)
+				if capt != nil {
+					capt.Cached = true
+				}
+				w.Header().Set("Content-Type", textXML)
+				w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+				w.Write(b)
+				return
+			}
+			cacheBuf = newCapBuffer(h.Cache.MaxEntrySize)
+			if rec.capture == nil {
+				rec.capture = cacheBuf
+			} else {
+				rec.capture = io.MultiWriter(rec.capture, cacheBuf)
+			}
+		}
+	}
+	logger.Info("Calling", "soapAction", request.Action, "inp", inpJSON)
 
 	var opts []grpc.CallOption
-	if u, p, ok := r.BasicAuth(); ok {
+	if u, p, ok := r.BasicAuth(); ok && ClaimsFromContext(ctx) == nil {
 		ctx = grpcer.WithBasicAuth(ctx, u, p)
 	}
-	if _, ok := ctx.Deadline(); !ok {
-		timeout := h.Timeout
-		if timeout == 0 {
-			timeout = DefaultTimeout
-		}
-		if timeout > 0 {
-			var cancel context.CancelFunc
-			ctx, cancel = context.WithTimeout(ctx, timeout)
-			defer cancel()
-		}
-	}
-	recv, err := h.Call(request.Action, ctx, inp, opts...)
+	timeout := h.callTimeout(request)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	callStart := time.Now()
+	cctx, cSpan := tracer.Start(ctx, "call", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("rpc.system", "grpc"), attribute.String("rpc.method", request.Action)))
+	recv, err := h.Call(request.Action, withDeadlineMetadata(injectGRPC(cctx, h.propagator())), inp, opts...)
+	stats.Call, stats.called = time.Since(callStart), true
+	endSpan(cSpan, err)
 	if h.LogRequest != nil {
-		h.LogRequest(ctx, buf.String(), err)
+		h.LogRequest(ctx, inpJSON, err)
 	}
 	if err != nil {
-		logger.Error("call", "action", request.Action, "inp", fmt.Sprintf("%+v", inp), "error", err)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = timeoutError{error: err, timeout: timeout}
+		}
+		logger.Error("call", "action", request.Action, "inp", inpJSON, "error", err)
+		if capt != nil {
+			capt.setError(err)
+		}
+		if h.LegacyAuthFault && isLegacyAuthError(err) {
+			err = authError{err}
+		}
 		soapError(w, err)
 		return
 	}
+	if capt != nil {
+		recv = captureReceiver{Receiver: recv, capture: capt}
+	}
+
+	encStart := time.Now()
+	ectx, eSpan := tracer.Start(ctx, "encode")
+	var encErr error
+	stats.Parts, stats.MergedFields, encErr = h.encodeResponse(ectx, w, recv, request)
+	stats.Encode, stats.ended = time.Since(encStart), true
+	eSpan.SetAttributes(attribute.Int("soap.response.parts", stats.Parts))
+	eSpan.End()
+	if errors.Is(encErr, ErrSpoolQuota) {
+		// Stop the backend, and do not send a truncated, yet well-formed looking response.
+		abort(encErr)
+		// What the gzip layer holds back must not be sent after the fault, or flushed as a complete looking response.
+		if ww, ok := ctx.Value(wireWriterKey{}).(*wireWriter); ok {
+			ww.discard = true
+			if !ww.sent { // answer the fault around the gzip layer
+				rec.ResponseWriter, rec.status, rec.written = ww.ResponseWriter, 0, 0
+			}
+		}
+		if rec.written == 0 {
+			soapError(w, encErr)
+			return
+		}
+		panic(http.ErrAbortHandler)
+	}
+	if cacheBuf != nil && encErr == nil && !cacheBuf.truncated && rec.fault == nil && rec.status == http.StatusOK && ctx.Err() == nil {
+		h.Cache.Store.Set(cacheKey, bytes.Clone(cacheBuf.Bytes()), time.Now().Add(cacheTTL))
+	}
+}
 
-	h.encodeResponse(ctx, w, recv, request)
+// responseRecorder wraps the http.ResponseWriter, recording the status code,
+// the number of bytes written and the SOAP fault (if any).
+// If capture is set, the response body is written into it, too.
+//
+// The first write error (the client is gone) is recorded, calls abort,
+// and is returned by all the subsequent writes.
+type responseRecorder struct {
+	http.ResponseWriter
+	capture  io.Writer
+	fault    *SOAPFault
+	faultErr error
+	writeErr error
+	abort    context.CancelCauseFunc
+	written  int64
+	status   int
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if rr.status == 0 {
+		rr.status = code
+	}
+	rr.ResponseWriter.WriteHeader(code)
+}
+func (rr *responseRecorder) Write(p []byte) (int, error) {
+	if rr.writeErr != nil {
+		return 0, rr.writeErr
+	}
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err := rr.ResponseWriter.Write(p)
+	rr.written += int64(n)
+	if rr.capture != nil {
+		rr.capture.Write(p[:n])
+	}
+	if err != nil {
+		rr.writeErr = err
+		if rr.abort != nil {
+			rr.abort(fmt.Errorf("%w: %w", errClientAborted, err))
+		}
+	}
+	return n, err
+}
+func (rr *responseRecorder) Flush() { http.NewResponseController(rr.ResponseWriter).Flush() }
+
+// Unwrap is for http.ResponseController.
+func (rr *responseRecorder) Unwrap() http.ResponseWriter { return rr.ResponseWriter }
+
+func (rr *responseRecorder) recordFault(fault SOAPFault, err error) {
+	if rr.fault == nil {
+		rr.fault, rr.faultErr = &fault, err
+	}
 }
 
 type requestInfo struct {
@@ -260,7 +551,8 @@ type requestInfo struct {
 	Action, SOAPAction string
 	Prefix, Postfix    string
 	Annotation
-	ForbidMerge bool
+	// RequestTimeout is the timeout requested by the client.
+	RequestTimeout time.Duration
 }
 
 func (info requestInfo) Name() string { return info.Action }
@@ -278,11 +570,14 @@ const (
 </` + prefix + `:Body></` + prefix + `:Envelope>`
 )
 
-func (h soapHandler) encodeResponse(ctx context.Context, w http.ResponseWriter, recv grpcer.Receiver, request requestInfo) {
+// encodeResponse encodes the received parts into w, returning the number of parts and merged fields.
+//
+// The returned error is the one which cut the response short, if any.
+// On ErrSpoolQuota nothing more is written (not even the envelope's end),
+// so the caller can answer a fault if nothing has been written yet, or abort the connection.
+func (h soapHandler) encodeResponse(ctx context.Context, w http.ResponseWriter, recv grpcer.Receiver, request requestInfo) (parts, mergedFields int, err error) {
 	logger := h.getLogger(ctx)
 	w.Header().Set("Content-Type", textXML)
-	// nosemgrep: go.lang.security.audit.xss.no-io-writestring-to-responsewriter.no-io-writestring-to-responsewriter
-	io.WriteString(w, soapEnvelopeHeader)
 
 	part, recvErr := recv.Recv()
 	next, nextErr := recv.Recv()
@@ -294,6 +589,8 @@ func (h soapHandler) encodeResponse(ctx context.Context, w http.ResponseWriter,
 
 	buf := bufPool.Get().(*bytes.Buffer)
 	defer bufPool.Put(buf)
+	// The envelope's start is held back till the first part is ready to be sent.
+	prelude := []byte(soapEnvelopeHeader)
 	if request.EncodeHeader != nil {
 		buf.Reset()
 		buf.WriteString("<" + prefix + ":Header>\n")
@@ -302,22 +599,37 @@ func (h soapHandler) encodeResponse(ctx context.Context, w http.ResponseWriter,
 		if hdrErr != nil {
 			logger.Error("EncodeHeader", "error", hdrErr)
 		} else {
+			prelude = append(prelude, buf.Bytes()...)
+		}
+	}
+	prelude = append(prelude, "<"+prefix+":Body>\n"...)
+	var started bool
+	start := func() {
+		if !started {
+			started = true
 			// nosemgrep: go.lang.security.audit.xss.no-direct-write-to-responsewriter.no-direct-write-to-responsewriter
-			w.Write(buf.Bytes())
+			w.Write(prelude)
 		}
 	}
-	io.WriteString(w, "<"+prefix+":Body>\n")
-	defer func() { io.WriteString(w, soapEnvelopeFooter) }()
+	defer func() {
+		if !errors.Is(err, ErrSpoolQuota) {
+			start()
+			// nosemgrep: go.lang.security.audit.xss.no-io-writestring-to-responsewriter.no-io-writestring-to-responsewriter
+			io.WriteString(w, soapEnvelopeFooter)
+		}
+	}()
 
 	if recvErr != nil {
+		start()
 		logger.Error("recv-error", "error", recvErr)
 		encodeSoapFault(w, recvErr, true)
-		return
+		return 0, 0, recvErr
 	}
 	if nextErr != nil && !errors.Is(nextErr, io.EOF) {
+		start()
 		logger.Error("next-error", "error", nextErr)
 		encodeSoapFault(w, nextErr, true)
-		return
+		return 0, 0, nextErr
 	}
 	typName := strings.TrimPrefix(fmt.Sprintf("%T", part), "*")
 	buf.Reset()
@@ -329,6 +641,7 @@ func (h soapHandler) encodeResponse(ctx context.Context, w http.ResponseWriter,
 	logger.Info("mayMerge", "shouldMerge", shouldMerge, "slice", slice)
 	if len(slice) == 0 {
 		// Nothing to merge
+		start()
 		mw := io.MultiWriter(w, buf)
 		enc := xml.NewEncoder(mw)
 		if request.Raw {
@@ -336,7 +649,6 @@ func (h soapHandler) encodeResponse(ctx context.Context, w http.ResponseWriter,
 		}
 		for {
 			buf.Reset()
-			var err error
 			if request.Raw {
 				// Use the first exported field
 				rv := reflect.ValueOf(part).Elem()
@@ -362,15 +674,32 @@ func (h soapHandler) encodeResponse(ctx context.Context, w http.ResponseWriter,
 			} else {
 				err = enc.Encode(part)
 			}
-			logger.Debug("found", "recv-xml", buf.String())
+			if logger.Enabled(ctx, slog.LevelDebug) {
+				logger.Debug("found", "recv-xml", h.Redactor.XML(buf.String()))
+			}
 			if err != nil {
-				logger.Error("encode", "part", part, "error", err)
+				logger.Error("encode", "part", h.Redactor.Value(part), "error", err)
 				break
 			}
+			parts++
 			// nosemgrep: go.lang.security.audit.xss.no-direct-write-to-responsewriter.no-direct-write-to-responsewriter
-			w.Write([]byte{'\n'})
-			if part, err = recv.Recv(); err != nil {
-				if !errors.Is(err, io.EOF) {
+			if _, err = w.Write([]byte{'\n'}); err != nil {
+				logger.Warn("write", "error", err)
+				break
+			}
+			flush(w)
+			if err = context.Cause(ctx); err != nil {
+				logger.Warn("stop encoding", "cause", err)
+				break
+			}
+			if next != nil {
+				part, next = next, nil
+			} else if nextErr != nil { // io.EOF after the first part
+				break
+			} else if part, err = recv.Recv(); err != nil {
+				if errors.Is(err, io.EOF) {
+					err = nil
+				} else {
 					logger.Error("recv", "error", err)
 				}
 				break
@@ -382,17 +711,24 @@ func (h soapHandler) encodeResponse(ctx context.Context, w http.ResponseWriter,
 		return
 	}
 
-	// Merge slices
+	// Merge slices: the elements of the first slice field are streamed as the parts arrive,
+	// the other fields' are spooled into temp files, and copied after the last part.
+	// The spooled fields of a part are encoded first, so the quota is checked before anything of the part is sent.
 	enc := xml.NewEncoder(buf)
-	ss := sliceSaver{files: make(map[string]*grpcer.TempFile, len(slice)), buf: buf, enc: enc}
+	ss := &sliceSaver{files: make(map[string]*grpcer.TempFile, len(slice)), buf: buf, enc: enc, quota: h.MaxSpoolSize}
 	fieldOrder := make([]string, 0, 2*len(slice))
 	for _, f := range slice {
 		fieldOrder = append(fieldOrder, f.Name)
 	}
 	defer ss.Close()
+	var head []byte
+	var suffix string
 	for {
+		if err = context.Cause(ctx); err != nil {
+			logger.Warn("stop merging", "cause", err)
+			return parts, 0, err
+		}
 		buf.Reset()
-		var err error
 		if next != nil { // first
 			// Encode a "part" with only the non-slice elements filled,
 			// strip & save the closing tag.
@@ -420,43 +756,63 @@ func (h soapHandler) encodeResponse(ctx context.Context, w http.ResponseWriter,
 				err = enc.Encode(rv.Interface())
 			}
 			if err != nil {
-				logger.Error("encode zero", "value", rv.Interface(), "error", err)
+				logger.Error("encode zero", "value", h.Redactor.Value(rv.Interface()), "error", err)
 				break
 			}
 			b := buf.Bytes()
 			_, end, ok := findOuterTag(b)
 			if !ok {
-				logger.Info("no findOuterTag", "b", string(b))
-				break
-			}
-			// nosemgrep: go.lang.security.audit.xss.no-direct-write-to-responsewriter.no-direct-write-to-responsewriter
-			if _, err = w.Write(b[:end[0]]); err != nil {
-				logger.Error("write", "error", err)
+				logger.Info("no findOuterTag", "b", h.Redactor.XML(string(b)))
+				err = errors.New("no outer tag")
 				break
 			}
-			// nosemgrep: go.lang.security.audit.xss.no-direct-write-to-responsewriter.no-direct-write-to-responsewriter
-			w.Write([]byte{'\n'})
-			suffix := string(b[end[0]:end[1]])
-			// nosemgrep: go.lang.security.audit.xss.no-io-writestring-to-responsewriter.no-io-writestring-to-responsewriter
-			defer io.WriteString(w, suffix)
+			// buf is reused by ss
+			head, suffix = bytes.Clone(b[:end[0]]), string(b[end[0]:end[1]])
 		}
 
-		// Encode slice fields, each into its separate file.
+		// Encode the other slice fields each into its separate file, then stream the first.
+		parts++
 		rv := reflect.ValueOf(part)
 		if rv.Kind() == reflect.Ptr {
 			rv = rv.Elem()
 		}
-		for _, f := range slice {
-			// nosemgrep: go.lang.security.audit.unsafe-reflect-by-name.unsafe-reflect-by-name
-			rf := rv.FieldByName(f.Name)
-			if rf.IsZero() || rf.Len() == 0 {
-				continue
+		for _, streamed := range []bool{false, true} {
+			if streamed && head != nil {
+				start()
+				// nosemgrep: go.lang.security.audit.xss.no-direct-write-to-responsewriter.no-direct-write-to-responsewriter
+				if _, err = w.Write(append(head, '\n')); err != nil {
+					logger.Error("write", "error", err)
+					break
+				}
+				head = nil
 			}
-			if err := ss.Encode(f.Name, rf.Interface()); err != nil {
-				logger.Error("encodeSliceField", "field", f.Name, "error", err)
+			for _, f := range slice {
+				if (f.Name == fieldOrder[0]) != streamed {
+					continue
+				}
+				// nosemgrep: go.lang.security.audit.unsafe-reflect-by-name.unsafe-reflect-by-name
+				rf := rv.FieldByName(f.Name)
+				if rf.IsZero() || rf.Len() == 0 {
+					continue
+				}
+				if streamed {
+					err = ss.Stream(w, f.Name, rf.Interface())
+				} else {
+					err = ss.Encode(f.Name, rf.Interface())
+				}
+				if err != nil {
+					logger.Error("encodeSliceField", "field", f.Name, "error", err)
+					break
+				}
+			}
+			if err != nil {
 				break
 			}
 		}
+		if err != nil {
+			break
+		}
+		flush(w)
 
 		if next != nil {
 			part, err, next = next, nextErr, nil
@@ -464,7 +820,9 @@ func (h soapHandler) encodeResponse(ctx context.Context, w http.ResponseWriter,
 			part, err = recv.Recv()
 		}
 		if err != nil {
-			if !errors.Is(err, io.EOF) {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			} else {
 				logger.Error("recv", "error", err)
 			}
 			break
@@ -483,28 +841,54 @@ func (h soapHandler) encodeResponse(ctx context.Context, w http.ResponseWriter,
 		}
 	}
 
-	logger.Info("copy", "files", ss.files)
-	for _, nm := range fieldOrder {
-		rc, err := ss.files[nm].GetReader()
+	mergedFields = len(fieldOrder)
+	if errors.Is(err, ErrSpoolQuota) {
+		return parts, mergedFields, err
+	}
+	logger.Info("copy", "files", ss.files, "spooled", ss.size)
+	for _, nm := range fieldOrder[1:] {
 		if err != nil {
-			logger.Error("GetReader", "file", nm, "error", err)
+			break
+		}
+		if err = context.Cause(ctx); err != nil {
+			logger.Warn("stop copying", "file", nm, "cause", err)
+			break
+		}
+		fh := ss.files[nm]
+		if fh == nil {
 			continue
 		}
+		rc, gErr := fh.GetReader()
+		if gErr != nil {
+			logger.Error("GetReader", "file", nm, "error", gErr)
+			err = gErr
+			break
+		}
 		_, err = io.Copy(w, rc)
 		rc.Close()
+		fh.Close()
 		if err != nil {
 			logger.Error("copy", "file", nm, "error", err)
 		}
 	}
+	// nosemgrep: go.lang.security.audit.xss.no-io-writestring-to-responsewriter.no-io-writestring-to-responsewriter
+	io.WriteString(w, suffix)
+	return parts, mergedFields, err
 }
 
+// ErrSpoolQuota is returned (wrapped) when the temp files of merging a response would exceed the MaxSpoolSize.
+var ErrSpoolQuota = errors.New("spool quota exceeded")
+
+// sliceSaver encodes the slice fields of the parts: streams them, or saves them into temp files.
 type sliceSaver struct {
 	buf   *bytes.Buffer
 	files map[string]*grpcer.TempFile
 	enc   *xml.Encoder
+	// quota of the (uncompressed) size of the temp files; zero means no limit.
+	quota, size int64
 }
 
-func (ss sliceSaver) Close() error {
+func (ss *sliceSaver) Close() error {
 	for k, f := range ss.files {
 		delete(ss.files, k)
 		if f != nil {
@@ -514,14 +898,36 @@ func (ss sliceSaver) Close() error {
 	return nil
 }
 
-func (ss sliceSaver) Encode(name string, value any) error {
+// encode the value as the elements named name, into buf.
+func (ss *sliceSaver) encode(name string, value any) ([]byte, error) {
 	ss.buf.Reset()
-	err := ss.enc.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: name}})
+	if err := ss.enc.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: name}}); err != nil {
+		return nil, err
+	}
+	ss.buf.WriteByte('\n')
+	return ss.buf.Bytes(), nil
+}
+
+// Stream the encoded value to w.
+func (ss *sliceSaver) Stream(w io.Writer, name string, value any) error {
+	b, err := ss.encode(name, value)
 	if err != nil {
 		return err
 	}
-	ss.buf.WriteByte('\n')
-	b := ss.buf.Bytes()
+	_, err = w.Write(b)
+	return err
+}
+
+// Encode the value into the temp file of the field.
+func (ss *sliceSaver) Encode(name string, value any) error {
+	b, err := ss.encode(name, value)
+	if err != nil {
+		return err
+	}
+	if ss.quota > 0 && ss.size+int64(len(b)) > ss.quota {
+		return fmt.Errorf("%s: %d+%d bytes > %d: %w", name, ss.size, len(b), ss.quota, ErrSpoolQuota)
+	}
+	ss.size += int64(len(b))
 
 	fh := ss.files[name]
 	if fh == nil {
@@ -534,8 +940,13 @@ func (ss sliceSaver) Encode(name string, value any) error {
 	return err
 }
 
+// flush the response to the client, so the parts arrive as they are encoded.
+func flush(w http.ResponseWriter) { _ = http.NewResponseController(w).Flush() }
+
 var (
 	errDecode = errors.New("decode XML")
+	// errClientAborted is the cause of the cancellation when the response cannot be written.
+	errClientAborted = errors.New("client aborted")
 )
 
 func (h soapHandler) DecodeRequest(ctx context.Context, r *http.Request) (grpcer.RequestInfo, any, error) {
@@ -543,19 +954,17 @@ func (h soapHandler) DecodeRequest(ctx context.Context, r *http.Request) (grpcer
 
 	sr, err := iohlp.MakeSectionReader(r.Body, 1<<20)
 	if err != nil {
-		return requestInfo{}, nil, err
+		return requestInfo{}, nil, asLimitError(err)
 	}
 
-	dec := newXMLDecoder(io.NewSectionReader(sr, 0, sr.Size()))
+	dec, inputOffset := h.Limits.newDecoder(io.NewSectionReader(sr, 0, sr.Size()))
 	st, err := findSoapBody(dec)
 	if err != nil {
-		b, _ := grpcer.ReadHeadTail(sr, 1024)
-		return requestInfo{}, nil, fmt.Errorf("findSoapBody in %s: %w", string(b), err)
+		return requestInfo{}, nil, fmt.Errorf("findSoapBody in %s: %w", h.Redactor.headTail(sr, 1024), err)
 	}
 	request := requestInfo{SOAPAction: strings.Trim(r.Header.Get("SOAPAction"), `"`)}
-	request.ForbidMerge, _ = strconv.ParseBool(r.Header.Get("Forbid-Merge"))
 	if h.DecodeHeader != nil {
-		hDec := newXMLDecoder(io.NewSectionReader(sr, 0, sr.Size()))
+		hDec, _ := h.Limits.newDecoder(io.NewSectionReader(sr, 0, sr.Size()))
 		hSt, err := findSoapElt("header", hDec)
 		if err != nil {
 			if !errors.Is(err, io.EOF) {
@@ -564,29 +973,45 @@ func (h soapHandler) DecodeRequest(ctx context.Context, r *http.Request) (grpcer
 		} else if hSt.Name.Local != "" {
 			_, encHeader, err := h.DecodeHeader(ctx, hDec, &hSt)
 			if err != nil {
-				b, _ := grpcer.ReadHeadTail(sr, 1024)
-				logger.Error("DecodeHeader", "header", string(b), "error", err)
+				logger.Error("DecodeHeader", "header", h.Redactor.headTail(sr, 1024), "error", err)
 				return request, nil, fmt.Errorf("decodeHeader: %w", err)
 			}
 			request.EncodeHeader = encHeader
 		}
 	}
 
-	request.Action = request.SOAPAction
-	if i := strings.LastIndex(request.Action, ".proto/"); i >= 0 {
-		request.Action = request.Action[i+7:]
+	if s := r.Header.Get(RequestTimeoutHeader); s != "" {
+		if d, err := parseRequestTimeout(s); err != nil {
+			logger.Warn("parse", "header", RequestTimeoutHeader, "value", s, "error", err)
+		} else {
+			request.RequestTimeout = d
+		}
 	}
-	if i := strings.IndexByte(request.Action, '/'); i >= 0 {
-		request.Action = request.Action[i+1:]
+	if h.TimeoutElement != "" {
+		tDec, _ := h.Limits.newDecoder(io.NewSectionReader(sr, 0, sr.Size()))
+		if s, err := soapHeaderText(tDec, h.TimeoutElement); err != nil {
+			logger.Warn("find", "element", h.TimeoutElement, "error", err)
+		} else if s != "" {
+			if d, err := parseRequestTimeout(s); err != nil {
+				logger.Warn("parse", "element", h.TimeoutElement, "value", s, "error", err)
+			} else {
+				request.RequestTimeout = d
+			}
+		}
 	}
+
+	request.Action = soapActionName(request.SOAPAction)
 	request.Annotation = h.annotation(request.Action)
+	if forbid, _ := strconv.ParseBool(r.Header.Get("Forbid-Merge")); forbid {
+		request.ForbidMerge = true
+	}
 	logger.Info("request", "soapAction", request.Action, "justRawXML", request.Raw)
 	if request.Raw {
-		startPos := dec.InputOffset()
+		startPos := inputOffset()
 		if err = dec.Skip(); err != nil {
 			return request, nil, fmt.Errorf("skip: %w", err)
 		}
-		b := make([]byte, dec.InputOffset()-startPos)
+		b := make([]byte, inputOffset()-startPos)
 		n, _ := sr.ReadAt(b, int64(startPos))
 		b = b[:n]
 		b = b[:bytes.LastIndex(b, []byte("</"))]
@@ -596,7 +1021,7 @@ func (h soapHandler) DecodeRequest(ctx context.Context, r *http.Request) (grpcer
 		logger.Info("raw", "prefix", request.Prefix, "postfix", request.Postfix)
 
 		inp := h.Input(request.Action)
-		logger.Info("raw", "rawXML", rawXML, "inp", fmt.Sprintf("%#v", inp), "T", fmt.Sprintf("%T", inp))
+		logger.Info("raw", "rawXML", h.Redactor.XML(rawXML), "inp", fmt.Sprintf("%#v", inp), "T", fmt.Sprintf("%T", inp))
 		rv := reflect.ValueOf(inp).Elem()
 		rt := rv.Type()
 		for i := 0; i < rt.NumField(); i++ {
@@ -608,8 +1033,7 @@ func (h soapHandler) DecodeRequest(ctx context.Context, r *http.Request) (grpcer
 		return request, inp, nil
 	}
 	if st, err = nextStart(dec); err != nil && !errors.Is(err, io.EOF) {
-		b, _ := grpcer.ReadHeadTail(sr, 1024)
-		return request, nil, fmt.Errorf("nextStart: %s: %w", string(b), err)
+		return request, nil, fmt.Errorf("nextStart: %s: %w", h.Redactor.headTail(sr, 1024), err)
 	}
 
 	if request.Action == "" {
@@ -619,8 +1043,7 @@ func (h soapHandler) DecodeRequest(ctx context.Context, r *http.Request) (grpcer
 	if h.DecodeInput != nil {
 		inp, err := h.DecodeInput(&request.Action, dec, &st)
 		if err != nil {
-			b, _ := grpcer.ReadHeadTail(sr, 1024)
-			return request, inp, fmt.Errorf("%s: %w", string(b), err)
+			return request, inp, fmt.Errorf("%s: %w", h.Redactor.headTail(sr, 1024), err)
 		}
 		return request, inp, nil
 	}
@@ -637,6 +1060,21 @@ func (h soapHandler) DecodeRequest(ctx context.Context, r *http.Request) (grpcer
 		}
 	}
 
+	if request.Validation == ValidateStrict {
+		vDec, _ := h.Limits.newDecoder(io.NewSectionReader(sr, 0, sr.Size()))
+		if _, err = findSoapBody(vDec); err == nil {
+			var vSt xml.StartElement
+			if vSt, err = nextStart(vDec); err == nil {
+				var path string
+				if path, err = unknownElement(vDec, vSt, inp); err == nil && path != "" {
+					return request, inp, fmt.Errorf("unknown element %s: %w", path, errDecode)
+				}
+			}
+		}
+		if err != nil {
+			return request, inp, fmt.Errorf("validate: %w", err)
+		}
+	}
 	if err = dec.DecodeElement(inp, &st); err != nil {
 		if errors.Is(err, io.EOF) {
 			if t := reflect.TypeOf(inp).Elem(); t.Kind() == reflect.Struct && t.NumField() == 0 {
@@ -648,14 +1086,25 @@ func (h soapHandler) DecodeRequest(ctx context.Context, r *http.Request) (grpcer
 			logger.Error("ERROR", "error", err)
 		}
 
-		b, _ := grpcer.ReadHeadTail(sr, 1024)
-		err = fmt.Errorf("into %T: %v\n%s: %w", inp, err, string(b), errDecode)
+		err = fmt.Errorf("into %T: %w\n%s: %w", inp, err, h.Redactor.headTail(sr, 1024), errDecode)
 	}
 	return request, inp, err
 }
 
 func (h soapHandler) getWSDL() string { return h.wsdlWithLocations }
 
+// soapActionName returns the operation name of the SOAPAction.
+func soapActionName(soapAction string) string {
+	action := strings.Trim(soapAction, `"`)
+	if i := strings.LastIndex(action, ".proto/"); i >= 0 {
+		action = action[i+7:]
+	}
+	if i := strings.IndexByte(action, '/'); i >= 0 {
+		action = action[i+1:]
+	}
+	return action
+}
+
 func (h soapHandler) annotation(soapAction string) (annotation Annotation) {
 	defer func() {
 		h.Info("annotations ends", "soapAction", soapAction, "annotation", annotation)
@@ -671,8 +1120,10 @@ func (h soapHandler) annotation(soapAction string) (annotation Annotation) {
 	return annotation
 }
 
-func mayFilterEmptyTags(r *http.Request, logger *slog.Logger) {
-	if !(r.Header.Get("Keep-Empty-Tags") == "1" || r.URL.Query().Get("keepEmptyTags") == "1") {
+// mayFilterEmptyTags filters the empty tags from the request body, unless asked not to.
+// Returns error only when the limits are exceeded.
+func mayFilterEmptyTags(r *http.Request, logger *slog.Logger, limits XMLLimits, redactor *Redactor, keep bool) error {
+	if !(keep || r.Header.Get("Keep-Empty-Tags") == "1" || r.URL.Query().Get("keepEmptyTags") == "1") {
 		//data = rEmptyTag.ReplaceAll(data, nil)
 		save := bufPool.Get().(*bytes.Buffer)
 		defer bufPool.Put(save)
@@ -680,8 +1131,11 @@ func mayFilterEmptyTags(r *http.Request, logger *slog.Logger) {
 		buf := bufPool.Get().(*bytes.Buffer)
 		defer bufPool.Put(buf)
 		buf.Reset()
-		if err := FilterEmptyTags(buf, io.TeeReader(r.Body, save)); err != nil {
-			logger.Info("FilterEmptyTags", "read", save.String(), "error", err)
+		if err := filterEmptyTags(buf, io.TeeReader(r.Body, save), limits); err != nil {
+			if err = asLimitError(err); errors.Is(err, ErrLimitExceeded) {
+				return err
+			}
+			logger.Info("FilterEmptyTags", "read", redactor.XML(save.String()), "error", err)
 			r.Body = struct {
 				io.Reader
 				io.Closer
@@ -693,21 +1147,22 @@ func mayFilterEmptyTags(r *http.Request, logger *slog.Logger) {
 			}{bytes.NewReader(buf.Bytes()), r.Body}
 		}
 	}
+	return nil
 }
 
 func soapError(w http.ResponseWriter, err error) {
-	w.Header().Set("Content-Type", textXML)
-	switch st := status.Convert(errors.Unwrap(err)); st.Code() {
+	switch status.Code(err) {
 	case codes.PermissionDenied, codes.Unauthenticated:
-		w.WriteHeader(http.StatusUnauthorized)
-	case codes.Unknown:
-		if st.Message() == "bad username or password" {
-			w.WriteHeader(http.StatusUnauthorized)
-		}
+		err = authError{err}
 	}
-
 	encodeSoapFault(w, err, false)
 }
+
+// isLegacyAuthError reports whether err is the legacy backends' authentication error.
+func isLegacyAuthError(err error) bool {
+	st, _ := status.FromError(err)
+	return st.Code() == codes.Unknown && st.Message() == "bad username or password"
+}
 func encodeSoapFault(w http.ResponseWriter, err error, justInner bool) error {
 	code := http.StatusInternalServerError
 	var c interface {
@@ -717,7 +1172,7 @@ func encodeSoapFault(w http.ResponseWriter, err error, justInner bool) error {
 		code = c.Code()
 	} else if errors.Is(err, context.Canceled) {
 		code = http.StatusFailedDependency
-	} else if errors.Is(err, context.DeadlineExceeded) {
+	} else if errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded {
 		code = http.StatusGatewayTimeout
 	}
 	// https://www.tutorialspoint.com/soap/soap_fault.html
@@ -745,6 +1200,9 @@ func encodeSoapFault(w http.ResponseWriter, err error, justInner bool) error {
 			fault.Code = prefix + ":Client"
 		}
 	}
+	if fr, ok := w.(interface{ recordFault(SOAPFault, error) }); ok {
+		fr.recordFault(fault, err)
+	}
 	w.Header().Set("Content-Type", textXML)
 	var buf bytes.Buffer
 	if !justInner {
@@ -790,7 +1248,7 @@ func findSoapElt(name string, dec *xml.Decoder) (xml.StartElement, error) {
 			if strings.EqualFold(st.Name.Local, name) {
 				switch st.Name.Space {
 				case "", "SOAP-ENV", prefix,
-					"http://www.w3.org/2003/05/soap-envelope/",
+					"http://www.w3.org/2003/05/soap-envelope/", soap12EnvelopeURI,
 					soapEnvelopeURI:
 					return st, nil
 				}
@@ -831,8 +1289,13 @@ func Ungzb64(s string) string {
 	return string(b)
 }
 
+// FilterEmptyTags copies the XML from r to w, without the empty elements.
 func FilterEmptyTags(w io.Writer, r io.Reader) error {
-	dec := newXMLDecoder(r)
+	return filterEmptyTags(w, r, XMLLimits{})
+}
+
+func filterEmptyTags(w io.Writer, r io.Reader, limits XMLLimits) error {
+	dec, _ := limits.newDecoder(r)
 	enc := xml.NewEncoder(w)
 	var unwritten []xml.Token
 	Unwrite := func() error {
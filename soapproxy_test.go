@@ -17,12 +17,15 @@ package soapproxy
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -273,3 +276,181 @@ func TestEncodeFault(t *testing.T) {
 		t.Errorf("got %s\nwanted %s", got, want)
 	}
 }
+
+type listOutput struct{ Items []string }
+
+// failingWriter fails after writing limit bytes.
+type failingWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.limit -= len(p); w.limit < 0 {
+		return 0, errors.New("broken pipe")
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func TestClientAbort(t *testing.T) {
+	m := NewMetrics()
+	for nm, forbidMerge := range map[string]bool{"write": true, "disconnect": false} {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		recv := stubRecv{Next: func(i int) any {
+			if i == 50 && !forbidMerge {
+				cancel()
+			}
+			return &listOutput{Items: []string{strings.Repeat("x", 100)}}
+		}}
+		h := NewSOAPHandler(SOAPHandlerConfig{Client: &stubClient{Respond: recv.Respond}, Logger: zlog.NewT(t).SLog(), Metrics: m})
+		req := httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+		req.Header.Set("SOAPAction", "Login")
+		var w http.ResponseWriter = httptest.NewRecorder()
+		if forbidMerge {
+			req.Header.Set("Forbid-Merge", "1")
+			w = &failingWriter{ResponseWriter: w, limit: 4096}
+		} else {
+			req = req.WithContext(ctx)
+		}
+		h.serveHTTP(w, req)
+		if recv.n > 100 {
+			t.Errorf("%s: %d parts received after the abort", nm, recv.n)
+		}
+		if recv.ctx.Err() == nil {
+			t.Errorf("%s: the call is not canceled", nm)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if want := `soapproxy_client_aborts_total{operation="Login"} 2`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("missing %q from %s", want, rec.Body.String())
+	}
+}
+
+type multiOutput struct {
+	Name string
+	A    []string
+	B    []int
+}
+
+func TestEncodeStreaming(t *testing.T) {
+	newParts := func() []any {
+		return []any{
+			&multiOutput{Name: "x", A: []string{"a0"}, B: []int{0}},
+			&multiOutput{A: []string{"a1"}, B: []int{1}},
+			&multiOutput{A: []string{"a2"}, B: []int{2}},
+		}
+	}
+	for nm, tc := range map[string]struct {
+		Want        []string
+		ForbidMerge bool
+	}{
+		"merge": {Want: []string{"<Name>x</Name>", "<A>a0</A>\n<A>a1</A>\n<A>a2</A>\n<B>0</B>\n<B>1</B>\n<B>2</B>\n</multiOutput>"}},
+		"forbidMerge": {ForbidMerge: true, Want: []string{
+			"<multiOutput><Name>x</Name><A>a0</A><B>0</B></multiOutput>",
+			"<multiOutput><Name></Name><A>a1</A><B>1</B></multiOutput>",
+			"<multiOutput><Name></Name><A>a2</A><B>2</B></multiOutput>",
+		}},
+	} {
+		rec := httptest.NewRecorder()
+		recv := stubRecv{Parts: newParts()}
+		if !tc.ForbidMerge {
+			recv.Check = func(i int) {
+				if i == 2 && !(rec.Flushed && strings.Contains(rec.Body.String(), "<A>a0</A>")) {
+					t.Errorf("%s: the first part is not flushed before the last arrives: %s", nm, rec.Body.String())
+				}
+			}
+		}
+		h := NewSOAPHandler(SOAPHandlerConfig{Client: &stubClient{Respond: recv.Respond}, Logger: zlog.NewT(t).SLog()})
+		req := httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+		req.Header.Set("SOAPAction", "Login")
+		if tc.ForbidMerge {
+			req.Header.Set("Forbid-Merge", "1")
+		}
+		h.serveHTTP(rec, req)
+		got := rec.Body.String()
+		t.Logf("%s: %s", nm, got)
+		for _, want := range tc.Want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: missing %q from %s", nm, want, got)
+			}
+		}
+		if strings.Contains(got, "Fault") {
+			t.Errorf("%s: fault: %s", nm, got)
+		}
+	}
+}
+
+func TestSpoolQuota(t *testing.T) {
+	// a <B> element is 9 bytes
+	for nm, tc := range map[string]struct {
+		Quota int64
+		Gzip  bool
+		Fault bool
+	}{
+		"first":      {Quota: 5, Fault: true},
+		"first gzip": {Quota: 5, Gzip: true, Fault: true},
+		"later":      {Quota: 20},
+		"later gzip": {Quota: 20, Gzip: true},
+	} {
+		recv := stubRecv{Parts: []any{
+			&multiOutput{Name: "x", A: []string{"a0"}, B: []int{0}},
+			&multiOutput{A: []string{"a1"}, B: []int{1}},
+			&multiOutput{A: []string{"a2"}, B: []int{2}},
+		}}
+		h := NewSOAPHandler(SOAPHandlerConfig{Client: &stubClient{Respond: recv.Respond}, Logger: zlog.NewT(t).SLog(), MaxSpoolSize: tc.Quota})
+		srv := httptest.NewServer(h)
+		req, _ := http.NewRequest("POST", srv.URL, strings.NewReader(loginRequest))
+		req.Header.Set("SOAPAction", "Login")
+		if !tc.Gzip { // the Transport asks for (and decompresses) gzip if no Accept-Encoding is set
+			req.Header.Set("Accept-Encoding", "identity")
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			srv.Close()
+			t.Fatalf("%s: %+v", nm, err)
+		}
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		srv.Close()
+		t.Logf("%s: %d %s (%v)", nm, resp.StatusCode, b, err)
+		if tc.Fault {
+			if err != nil || resp.StatusCode != http.StatusInternalServerError ||
+				!bytes.Contains(b, []byte("spool quota exceeded")) || bytes.Contains(b, []byte("<A>")) {
+				t.Errorf("%s: wanted a fault, got %d %s (%v)", nm, resp.StatusCode, b, err)
+			}
+		} else if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: wanted an aborted response, got %d %s (%v)", nm, resp.StatusCode, b, err)
+		}
+		if cause := context.Cause(recv.ctx); !errors.Is(cause, ErrSpoolQuota) {
+			t.Errorf("%s: the call is not canceled: %v", nm, cause)
+		}
+		if !tc.Gzip || tc.Fault {
+			continue
+		}
+
+		// the gzip layer must not end the compressed stream of the aborted response
+		recv.n = 0
+		req = httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+		req.Header.Set("SOAPAction", "Login")
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		func() {
+			defer func() {
+				if p := recover(); p != http.ErrAbortHandler {
+					t.Errorf("%s: got panic %v, wanted ErrAbortHandler", nm, p)
+				}
+			}()
+			h.ServeHTTP(rec, req)
+		}()
+		zr, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatalf("%s: %+v", nm, err)
+		}
+		if b, err = io.ReadAll(zr); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: wanted a truncated gzip stream, got %s (%v)", nm, b, err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Command soapreplay replays the captured calls of a directory
+// (as written by the handler with CaptureDir set, e.g. mockproxy -capture),
+// printing the canonical differences of the produced and the captured responses,
+// and exits with a non-zero code if any of them differ.
+//
+// The inputs are decoded with the generic input of mockclient.Client.
+// For the captures of a proxy with a generated Client, call soapproxy.ReplayReport
+// with that Client and its part types from a command of its own.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	soapproxy "github.com/UNO-SOFT/soap-proxy"
+	"github.com/UNO-SOFT/soap-proxy/mockclient"
+)
+
+func main() {
+	if err := Main(); err != nil {
+		slog.Error("main", "error", err)
+		os.Exit(1)
+	}
+}
+
+func Main() error {
+	flagWSDL := flag.String("wsdl", "", "WSDL file of the service")
+	flagAnnotations := flag.String("annotations", "", "JSON or YAML file of the operations' annotations")
+	flagMock := flag.String("mock", "", "directory of the canned responses, for the list of the operations")
+	flagVerbose := flag.Bool("v", false, "verbose logging")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <capture dir>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		return fmt.Errorf("the capture directory is required")
+	}
+
+	level := slog.LevelWarn
+	if *flagVerbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	conf := soapproxy.SOAPHandlerConfig{
+		Client: mockclient.Client{Dir: *flagMock},
+		Logger: logger,
+	}
+	if *flagWSDL != "" {
+		b, err := os.ReadFile(*flagWSDL)
+		if err != nil {
+			return err
+		}
+		conf.WSDL = string(b)
+	}
+	if *flagAnnotations != "" {
+		var err error
+		if conf.Annotations, err = soapproxy.LoadAnnotations(*flagAnnotations); err != nil {
+			return err
+		}
+	}
+
+	if err := conf.Validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	return soapproxy.ReplayReport(ctx, conf, flag.Arg(0), mockclient.NewPart, os.Stdout)
+}
@@ -0,0 +1,112 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/UNO-SOFT/grpcer"
+	"google.golang.org/grpc"
+)
+
+type loginOutput struct{ PHibaKod int }
+
+// stubClient is the grpcer.Client of the tests: it records the contexts of the calls,
+// and answers them with Respond, or with one loginOutput part if Respond is nil.
+type stubClient struct {
+	nullClient
+	// Operations are returned by List.
+	Operations []string
+	// Inputs make the inputs of the operations, besides the nullClient's.
+	Inputs map[string]func() any
+	// Respond answers the calls, if set.
+	Respond func(ctx context.Context, name string) (grpcer.Receiver, error)
+
+	mu    sync.Mutex
+	calls []context.Context
+}
+
+func (c *stubClient) List() []string { return c.Operations }
+func (c *stubClient) Input(name string) any {
+	if f := c.Inputs[name]; f != nil {
+		return f()
+	}
+	return c.nullClient.Input(name)
+}
+func (c *stubClient) Call(name string, ctx context.Context, input any, opts ...grpc.CallOption) (grpcer.Receiver, error) {
+	c.mu.Lock()
+	c.calls = append(c.calls, ctx)
+	c.mu.Unlock()
+	if c.Respond != nil {
+		return c.Respond(ctx, name)
+	}
+	return &stubRecv{Parts: []any{&loginOutput{}}}, nil
+}
+
+// Calls returns the contexts of the calls, and forgets them if reset is set.
+func (c *stubClient) Calls(reset bool) []context.Context {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	calls := c.calls
+	if reset {
+		c.calls = nil
+	}
+	return calls
+}
+
+// stubRecv returns the Parts, then the parts made by Next (if set), then Err (io.EOF if nil).
+// It stops with the error of the call's context, if its Respond has been used.
+type stubRecv struct {
+	ctx context.Context
+	// Check is called before each part, with its index.
+	Check func(i int)
+	// Next makes the i-th part after the Parts, if set.
+	Next  func(i int) any
+	Parts []any
+	Err   error
+	n     int
+}
+
+func (r *stubRecv) Recv() (any, error) {
+	if r.ctx != nil {
+		if err := r.ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	i := r.n
+	if i >= len(r.Parts) && r.Next == nil {
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return nil, io.EOF
+	}
+	if r.Check != nil {
+		r.Check(i)
+	}
+	r.n++
+	if i < len(r.Parts) {
+		return r.Parts[i], nil
+	}
+	return r.Next(i), nil
+}
+
+// Respond returns r for the call, stopping with its context.
+func (r *stubRecv) Respond(ctx context.Context, name string) (grpcer.Receiver, error) {
+	r.ctx = ctx
+	return r, nil
+}
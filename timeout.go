@@ -0,0 +1,132 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestTimeoutHeader is the HTTP header (and the gRPC metadata key) of the requested timeout,
+// in seconds (or as a time.ParseDuration string).
+const RequestTimeoutHeader = "Request-Timeout"
+
+// parseRequestTimeout parses the seconds or the time.ParseDuration string.
+func parseRequestTimeout(s string) (time.Duration, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		switch {
+		case math.IsNaN(f):
+			return 0, errors.New("timeout is not a number")
+		case f < 0:
+			return 0, errors.New("negative timeout")
+		case f >= math.MaxInt64/float64(time.Second): // the overflowing conversion is undefined
+			return 0, errors.New("timeout too long")
+		}
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d < 0 {
+		err = errors.New("negative timeout")
+	}
+	return d, err
+}
+
+// soapHeaderText returns the text of the first element named name in the SOAP Header, if any.
+func soapHeaderText(dec *xml.Decoder, name string) (string, error) {
+	var inHeader bool
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return "", err
+		}
+		switch x := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case inHeader && x.Name.Local == name:
+				var s string
+				err = dec.DecodeElement(&s, &x)
+				return strings.TrimSpace(s), err
+			case strings.EqualFold(x.Name.Local, "header"):
+				inHeader = true
+			case strings.EqualFold(x.Name.Local, "body"):
+				return "", nil
+			}
+		case xml.EndElement:
+			if inHeader && strings.EqualFold(x.Name.Local, "header") {
+				return "", nil
+			}
+		}
+	}
+}
+
+// callTimeout returns the timeout of the call: the operation's (or the handler's) timeout,
+// or the timeout requested by the client, capped by MaxTimeout.
+func (h soapHandler) callTimeout(request requestInfo) time.Duration {
+	timeout := request.Timeout
+	if timeout == 0 {
+		timeout = h.Timeout
+	}
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	if request.RequestTimeout <= 0 {
+		return timeout
+	}
+	limit := h.MaxTimeout
+	if limit == 0 {
+		limit = timeout
+	}
+	if limit <= 0 || request.RequestTimeout < limit {
+		return request.RequestTimeout
+	}
+	return limit
+}
+
+// withDeadlineMetadata adds the remaining time till the deadline of the context
+// to the outgoing gRPC metadata, as the Request-Timeout header.
+//
+// (gRPC propagates the deadline itself, this is for the backends looking at the metadata only.)
+func withDeadlineMetadata(ctx context.Context) context.Context {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, strings.ToLower(RequestTimeoutHeader),
+		strconv.FormatFloat(time.Until(deadline).Seconds(), 'f', 3, 64))
+}
+
+// timeoutError is returned when the call does not finish in time, mapped to 504 and soapenv:Server fault.
+type timeoutError struct {
+	error
+	timeout time.Duration
+}
+
+func (e timeoutError) Unwrap() error       { return e.error }
+func (e timeoutError) Code() int           { return http.StatusGatewayTimeout }
+func (e timeoutError) FaultCode() string   { return prefix + ":Server" }
+func (e timeoutError) FaultString() string { return "timeout: no response in " + e.timeout.String() }
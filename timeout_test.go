@@ -0,0 +1,108 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/grpcer"
+	"github.com/UNO-SOFT/zlog/v2"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestCallTimeout(t *testing.T) {
+	for i, tc := range []struct {
+		Handler, Max, Operation, Requested, Want time.Duration
+	}{
+		{Want: DefaultTimeout},
+		{Handler: time.Minute, Want: time.Minute},
+		{Handler: time.Minute, Operation: time.Second, Want: time.Second},
+		{Handler: time.Minute, Requested: time.Second, Want: time.Second},
+		{Handler: time.Minute, Requested: time.Hour, Want: time.Minute},
+		{Handler: time.Minute, Max: 2 * time.Hour, Requested: time.Hour, Want: time.Hour},
+		{Handler: time.Minute, Max: 2 * time.Minute, Requested: time.Hour, Want: 2 * time.Minute},
+		{Handler: -1, Requested: time.Hour, Want: time.Hour},
+	} {
+		h := soapHandler{SOAPHandlerConfig: SOAPHandlerConfig{Timeout: tc.Handler, MaxTimeout: tc.Max}}
+		got := h.callTimeout(requestInfo{Annotation: Annotation{Timeout: tc.Operation}, RequestTimeout: tc.Requested})
+		if got != tc.Want {
+			t.Errorf("%d. %+v: got %s", i, tc, got)
+		}
+	}
+
+	for s, want := range map[string]time.Duration{"1.5": 1500 * time.Millisecond, "2m": 2 * time.Minute, "-1": -1, "soon": -1,
+		"NaN": -1, "Inf": -1, "-Inf": -1, "1e300": -1, "9223372037": -1, "9223372036": 9223372036 * time.Second,
+	} {
+		got, err := parseRequestTimeout(s)
+		if want < 0 {
+			if err == nil {
+				t.Errorf("%q: wanted error, got %s", s, got)
+			}
+		} else if err != nil || got != want {
+			t.Errorf("%q: got %s, %+v; wanted %s", s, got, err, want)
+		}
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	cl := stubClient{Respond: func(ctx context.Context, name string) (grpcer.Receiver, error) {
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}}
+	h := NewSOAPHandler(SOAPHandlerConfig{Client: &cl, Logger: zlog.NewT(t).SLog(),
+		Timeout: time.Minute, TimeoutElement: "RequestTimeout"})
+	for nm, tc := range map[string]struct {
+		Header, Element string
+	}{
+		"header":  {Header: "0.1"},
+		"element": {Element: "100ms"},
+	} {
+		request := loginRequest
+		if tc.Element != "" {
+			request = strings.Replace(request, "</head:IMSSOAPHeader>",
+				"</head:IMSSOAPHeader><head:RequestTimeout>"+tc.Element+"</head:RequestTimeout>", 1)
+		}
+		req := httptest.NewRequest("POST", "/", strings.NewReader(request))
+		req.Header.Set("SOAPAction", "Login")
+		if tc.Header != "" {
+			req.Header.Set(RequestTimeoutHeader, tc.Header)
+		}
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		h.serveHTTP(rec, req)
+		if dur := time.Since(start); dur > 10*time.Second {
+			t.Errorf("%s: took %s", nm, dur)
+		}
+		if rec.Code != http.StatusGatewayTimeout {
+			t.Errorf("%s: got %d, wanted %d", nm, rec.Code, http.StatusGatewayTimeout)
+		}
+		if body := rec.Body.String(); !strings.Contains(body, "<faultcode>soapenv:Server</faultcode>") || !strings.Contains(body, "timeout: no response in 100ms") {
+			t.Errorf("%s: no timeout fault: %s", nm, body)
+		}
+		md, _ := metadata.FromOutgoingContext(cl.Calls(true)[0])
+		timeout := strings.Join(md.Get("request-timeout"), ",")
+		if f, err := strconv.ParseFloat(timeout, 64); err != nil || f <= 0 || f > 0.1 {
+			t.Errorf("%s: got %q request-timeout metadata", nm, timeout)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const tracerName = "github.com/UNO-SOFT/soap-proxy"
+
+// ClientTracerProvider is the TracerProvider of the SOAPCall* functions,
+// and of the Clients without a TracerProvider.
+// If nil, the global otel.GetTracerProvider() is used.
+var ClientTracerProvider trace.TracerProvider
+
+// defaultPropagator propagates the W3C traceparent and baggage.
+var defaultPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+func (c SOAPHandlerConfig) tracer() trace.Tracer {
+	tp := c.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+func (c SOAPHandlerConfig) propagator() propagation.TextMapPropagator {
+	if c.Propagator != nil {
+		return c.Propagator
+	}
+	return defaultPropagator
+}
+
+func (c *Client) tracer() trace.Tracer {
+	tp := c.TracerProvider
+	if tp == nil {
+		tp = ClientTracerProvider
+	}
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// injectGRPC injects the trace context of ctx into the outgoing gRPC metadata.
+func injectGRPC(ctx context.Context, prop propagation.TextMapPropagator) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	prop.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// metadataCarrier adapts metadata.MD to propagation.TextMapCarrier.
+type metadataCarrier metadata.MD
+
+func (mc metadataCarrier) Get(key string) string {
+	if vv := metadata.MD(mc).Get(key); len(vv) != 0 {
+		return vv[0]
+	}
+	return ""
+}
+func (mc metadataCarrier) Set(key, value string) { metadata.MD(mc).Set(key, value) }
+func (mc metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(mc))
+	for k := range mc {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// endSpan ends the span, recording the error.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		if st, ok := status.FromError(err); ok {
+			span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(st.Code())))
+		}
+	}
+	span.End()
+}
+
+// endServerSpan ends the server span, recording the HTTP status and the SOAP fault.
+func endServerSpan(span trace.Span, rec *responseRecorder) {
+	if rec.status != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", rec.status))
+	}
+	if rec.fault != nil {
+		span.SetAttributes(attribute.String("soap.fault.code", rec.fault.Code))
+		endSpan(span, rec.faultErr)
+		return
+	}
+	span.End()
+}
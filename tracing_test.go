@@ -0,0 +1,107 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package soapproxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/UNO-SOFT/zlog/v2"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc/metadata"
+)
+
+func newTestTracerProvider() (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exp := tracetest.NewInMemoryExporter()
+	return sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp)), exp
+}
+
+func TestServerTracing(t *testing.T) {
+	tp, exp := newTestTracerProvider()
+	var cl stubClient
+	h := NewSOAPHandler(SOAPHandlerConfig{Client: &cl, Logger: zlog.NewT(t).SLog(), TracerProvider: tp})
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("POST", "/", strings.NewReader(loginRequest))
+	req.Header.Set("SOAPAction", "Login")
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	h.serveHTTP(httptest.NewRecorder(), req)
+
+	spans := exp.GetSpans()
+	names := make(map[string]tracetest.SpanStub, len(spans))
+	for _, s := range spans {
+		names[s.Name] = s
+		if got := s.SpanContext.TraceID().String(); got != traceID {
+			t.Errorf("%s: got trace %s, wanted %s", s.Name, got, traceID)
+		}
+	}
+	for _, nm := range []string{"Login", "decode", "call", "encode"} {
+		if _, ok := names[nm]; !ok {
+			t.Errorf("no %q span in %v", nm, spans)
+		}
+	}
+	calls := cl.Calls(false)
+	if len(calls) != 1 {
+		t.Fatalf("got %d calls", len(calls))
+	}
+	md, _ := metadata.FromOutgoingContext(calls[0])
+	tp0 := md.Get("traceparent")
+	if len(tp0) != 1 || !strings.Contains(tp0[0], traceID) || !strings.Contains(tp0[0], names["call"].SpanContext.SpanID().String()) {
+		t.Errorf("got traceparent metadata %q, wanted the call span %s", tp0, names["call"].SpanContext.SpanID())
+	}
+}
+
+func TestClientTracing(t *testing.T) {
+	tp, exp := newTestTracerProvider()
+	old := ClientTracerProvider
+	ClientTracerProvider = tp
+	defer func() { ClientTracerProvider = old }()
+
+	var n atomic.Int32
+	var gotParent atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotParent.Store(r.Header.Get("traceparent"))
+		if n.Add(1) == 1 { // fail the first attempt
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, SOAPHeader+SOAPBody+`<Resp><A>1</A></Resp>`+SOAPFooter)
+	}))
+	defer srv.Close()
+	var resp struct{ A int }
+	if err := SOAPCall(context.Background(), srv.URL, "Act", "<Req/>", &resp, zlog.NewT(t).SLog()); err != nil {
+		t.Fatal(err)
+	}
+	var attempts int
+	var last tracetest.SpanStub
+	for _, s := range exp.GetSpans() {
+		if s.Name == "attempt" {
+			attempts++
+			last = s
+		}
+	}
+	if attempts != 2 {
+		t.Errorf("got %d attempt spans, wanted 2", attempts)
+	}
+	if p, _ := gotParent.Load().(string); !strings.Contains(p, last.SpanContext.SpanID().String()) {
+		t.Errorf("got traceparent %q, wanted span %s", p, last.SpanContext.SpanID())
+	}
+}
@@ -0,0 +1,667 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"aqwari.net/xml/xmltree"
+)
+
+const (
+	wsdlNS = "http://schemas.xmlsoap.org/wsdl/"
+	xsdNS  = "http://www.w3.org/2001/XMLSchema"
+
+	timestampType = "google.protobuf.Timestamp"
+)
+
+// Options of Convert.
+type Options struct {
+	// Package is the proto package. If empty, it is derived from the common prefix
+	// of the element names, or the portType's name.
+	Package string
+	// GoPackage is the go_package option, if not empty.
+	GoPackage string
+	// PortType to convert, the first if empty.
+	PortType string
+}
+
+// Convert the WSDL (docs[0], with the additional schemas) into a .proto.
+func Convert(opts Options, docs ...[]byte) ([]byte, error) {
+	if len(docs) == 0 {
+		return nil, errors.New("no WSDL given")
+	}
+	c := converter{
+		elements:     make(map[xml.Name]*xmltree.Element),
+		complexTypes: make(map[xml.Name]*xmltree.Element),
+		simpleTypes:  make(map[xml.Name]*xmltree.Element),
+		typeMessages: make(map[xml.Name]string),
+		messages:     make(map[string]bool),
+	}
+	var root *xmltree.Element
+	for i, doc := range docs {
+		el, err := xmltree.Parse(doc)
+		if err != nil {
+			return nil, fmt.Errorf("parse %d. document: %w", i, err)
+		}
+		if i == 0 {
+			root = el
+		}
+		c.addSchemas(el)
+	}
+	targetNS := root.Attr("", "targetNamespace")
+
+	var pt *xmltree.Element
+	for _, el := range root.Search(wsdlNS, "portType") {
+		if opts.PortType == "" || el.Attr("", "name") == opts.PortType {
+			pt = el
+			break
+		}
+	}
+	if pt == nil {
+		return nil, fmt.Errorf("portType %q not found", opts.PortType)
+	}
+	c.service.Name = pt.Attr("", "name")
+	c.service.Doc = documentation(pt)
+
+	type opElements struct {
+		op            *xmltree.Element
+		input, output xml.Name
+	}
+	ops := make([]opElements, 0, 16)
+	for _, op := range pt.Search(wsdlNS, "operation") {
+		oe := opElements{op: op}
+		var err error
+		for _, inp := range op.Search(wsdlNS, "input") {
+			oe.input, err = messageElement(root, targetNS, inp.Resolve(inp.Attr("", "message")))
+		}
+		for _, out := range op.Search(wsdlNS, "output") {
+			if err == nil {
+				oe.output, err = messageElement(root, targetNS, out.Resolve(out.Attr("", "message")))
+			}
+		}
+		if err == nil && (oe.input.Local == "" || oe.output.Local == "") {
+			err = errors.New("only request-response operations are supported")
+		}
+		if err != nil {
+			logger.Warn("skip operation", "operation", op.Attr("", "name"), "error", err)
+			continue
+		}
+		ops = append(ops, oe)
+	}
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("portType %q has no convertible operation", c.service.Name)
+	}
+
+	c.pkg = opts.Package
+	if c.pkg == "" {
+		names := make([]string, 0, 2*len(ops))
+		for _, oe := range ops {
+			names = append(names, oe.input.Local, oe.output.Local)
+		}
+		c.pkg = derivePackage(c.service.Name, names)
+	}
+
+	for _, oe := range ops {
+		name := oe.op.Attr("", "name")
+		m := method{Name: name, Doc: documentation(oe.op),
+			Input: name + "_Input", Output: name + "_Output",
+		}
+		for _, x := range []struct {
+			Message string
+			Element xml.Name
+			AnyName string
+		}{{m.Input, oe.input, "p_raw_xml"}, {m.Output, oe.output, "ret"}} {
+			if got := mkTypeName(c.pkg, x.Message); got != x.Element.Local {
+				logger.Warn("element will be renamed", "operation", name, "element", x.Element.Local, "new", got)
+			}
+			el := c.elements[x.Element]
+			if el == nil {
+				return nil, fmt.Errorf("%s: element %s not found", name, x.Element.Local)
+			}
+			if err := c.elementMessage(x.Message, el, x.AnyName); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		c.service.Methods = append(c.service.Methods, m)
+	}
+
+	var buf bytes.Buffer
+	if err := protoTemplate.Execute(&buf, struct {
+		Package, GoPackage string
+		Timestamp          bool
+		Messages           []*message
+		Service            service
+	}{Package: c.pkg, GoPackage: opts.GoPackage, Timestamp: c.timestamp,
+		Messages: c.ordered, Service: c.service,
+	}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type converter struct {
+	elements, complexTypes, simpleTypes map[xml.Name]*xmltree.Element
+	// typeMessages maps the complexTypes to their message names.
+	typeMessages map[xml.Name]string
+	messages     map[string]bool
+	ordered      []*message
+	service      service
+	pkg          string
+	timestamp    bool
+}
+
+type service struct {
+	Name, Doc string
+	Methods   []method
+}
+
+type method struct {
+	Name, Doc, Input, Output string
+}
+
+type message struct {
+	Name, Doc string
+	Fields    []field
+}
+
+type field struct {
+	Name, Type, Doc string
+	Number          int
+	Repeated        bool
+}
+
+// addSchemas registers the global elements and types of the xs:schemas in el.
+func (c *converter) addSchemas(el *xmltree.Element) {
+	schemas := el.Search(xsdNS, "schema")
+	if el.Name.Space == xsdNS && el.Name.Local == "schema" {
+		schemas = append(schemas, el)
+	}
+	for _, schema := range schemas {
+		tns := schema.Attr("", "targetNamespace")
+		for i := range schema.Children {
+			child := &schema.Children[i]
+			if child.Name.Space != xsdNS {
+				continue
+			}
+			name := xml.Name{Space: tns, Local: child.Attr("", "name")}
+			switch child.Name.Local {
+			case "element":
+				c.elements[name] = child
+			case "complexType":
+				c.complexTypes[name] = child
+			case "simpleType":
+				c.simpleTypes[name] = child
+			}
+		}
+	}
+}
+
+// messageElement returns the element of the WSDL message's sole part.
+func messageElement(root *xmltree.Element, targetNS string, name xml.Name) (xml.Name, error) {
+	msgs := root.SearchFunc(func(el *xmltree.Element) bool {
+		return el.Name.Space == wsdlNS && el.Name.Local == "message" &&
+			el.ResolveDefault(el.Attr("", "name"), targetNS) == name
+	})
+	if len(msgs) == 0 {
+		return xml.Name{}, fmt.Errorf("message %s not found", name.Local)
+	}
+	parts := msgs[0].Search(wsdlNS, "part")
+	if len(parts) != 1 || parts[0].Attr("", "element") == "" {
+		return xml.Name{}, fmt.Errorf("message %s: only single element parts are supported", name.Local)
+	}
+	return parts[0].Resolve(parts[0].Attr("", "element")), nil
+}
+
+// elementMessage adds the message of the global element.
+//
+// A sequence of xs:any is converted to a single string field named anyName,
+// as protoc-gen-wsdl converts it back.
+func (c *converter) elementMessage(name string, el *xmltree.Element, anyName string) error {
+	m := &message{Name: name, Doc: documentation(el)}
+	c.add(m)
+	ct := child(el, "complexType")
+	if typ := el.Attr("", "type"); typ != "" {
+		ct = c.complexTypes[el.Resolve(typ)]
+		if ct == nil {
+			return fmt.Errorf("%s: complexType %s not found", el.Attr("", "name"), typ)
+		}
+	}
+	if ct == nil {
+		return fmt.Errorf("%s: not a complex element", el.Attr("", "name"))
+	}
+	if isAny(ct) {
+		m.Fields = []field{{Name: anyName, Type: "string", Number: 1}}
+		return nil
+	}
+	return c.fields(m, ct)
+}
+
+func (c *converter) add(m *message) {
+	c.messages[m.Name] = true
+	c.ordered = append(c.ordered, m)
+}
+
+// typeMessage returns the name of the message of the named complexType, adding it if needed.
+func (c *converter) typeMessage(name xml.Name) (string, error) {
+	if nm, ok := c.typeMessages[name]; ok {
+		return nm, nil
+	}
+	ct := c.complexTypes[name]
+	if ct == nil {
+		return "", fmt.Errorf("complexType %s not found", name.Local)
+	}
+	nm := strings.TrimPrefix(name.Local, camelCase(c.pkg)+"_")
+	if got := mkTypeName(c.pkg, nm); got != name.Local {
+		logger.Warn("complexType will be renamed", "type", name.Local, "new", got)
+	}
+	c.typeMessages[name] = nm
+	m := &message{Name: nm, Doc: documentation(ct)}
+	c.add(m)
+	return nm, c.fields(m, ct)
+}
+
+// fields appends the fields of the complexType (or its content) to m.
+func (c *converter) fields(m *message, ct *xmltree.Element) error {
+	for i := range ct.Children {
+		el := &ct.Children[i]
+		if el.Name.Space != xsdNS {
+			continue
+		}
+		switch el.Name.Local {
+		case "sequence", "all":
+			if err := c.fields(m, el); err != nil {
+				return err
+			}
+		case "choice":
+			logger.Warn("choice is converted to a sequence", "message", m.Name)
+			if err := c.fields(m, el); err != nil {
+				return err
+			}
+		case "complexContent":
+			for _, ext := range el.Search(xsdNS, "extension") {
+				if base := c.complexTypes[ext.Resolve(ext.Attr("", "base"))]; base != nil {
+					if err := c.fields(m, base); err != nil {
+						return err
+					}
+				}
+				if err := c.fields(m, ext); err != nil {
+					return err
+				}
+			}
+		case "element":
+			f, err := c.field(m, el)
+			if err != nil {
+				return err
+			}
+			f.Number = len(m.Fields) + 1
+			m.Fields = append(m.Fields, f)
+		case "attribute", "attributeGroup", "any", "anyAttribute":
+			logger.Warn("skip unsupported "+el.Name.Local, "message", m.Name, "name", el.Attr("", "name"))
+		}
+	}
+	return nil
+}
+
+func (c *converter) field(m *message, el *xmltree.Element) (field, error) {
+	if ref := el.Attr("", "ref"); ref != "" {
+		refEl := c.elements[el.Resolve(ref)]
+		if refEl == nil {
+			return field{}, fmt.Errorf("%s: element %s not found", m.Name, ref)
+		}
+		f, err := c.field(m, refEl)
+		f.Repeated = isRepeated(el)
+		return f, err
+	}
+	name := el.Attr("", "name")
+	f := field{Name: snakeCase(name), Doc: documentation(el), Repeated: isRepeated(el)}
+	if got := camelCase(f.Name); got != name {
+		logger.Warn("element will be renamed", "message", m.Name, "element", name, "new", got)
+	}
+	var oraType string
+	if typ := el.Attr("", "type"); typ != "" {
+		qn := el.Resolve(typ)
+		if _, ok := c.complexTypes[qn]; ok && qn.Space != xsdNS {
+			nm, err := c.typeMessage(qn)
+			if err != nil {
+				return f, fmt.Errorf("%s.%s: %w", m.Name, name, err)
+			}
+			f.Type = nm
+		} else {
+			f.Type, oraType = c.simpleType(qn, nil)
+		}
+	} else if ct := child(el, "complexType"); ct != nil {
+		nm := m.Name + "_" + name
+		for c.messages[nm] {
+			nm += "_"
+		}
+		sub := &message{Name: nm, Doc: documentation(ct)}
+		c.add(sub)
+		if err := c.fields(sub, ct); err != nil {
+			return f, err
+		}
+		f.Type = nm
+	} else if st := child(el, "simpleType"); st != nil {
+		f.Type, oraType = c.simpleType(xml.Name{}, st)
+	} else {
+		f.Type = "string"
+	}
+	if f.Type == timestampType {
+		c.timestamp = true
+	}
+	if oraType != "" {
+		if f.Doc != "" {
+			f.Doc += "\n"
+		}
+		f.Doc += oraType
+	}
+	return f, nil
+}
+
+// simpleType returns the proto type and the Oracle type (for xsdTypeFromDocu) of the named
+// simple type, or st if it is not nil.
+func (c *converter) simpleType(name xml.Name, st *xmltree.Element) (string, string) {
+	if st == nil {
+		if name.Space == xsdNS {
+			return builtinType(name.Local)
+		}
+		if st = c.simpleTypes[name]; st == nil {
+			logger.Warn("unknown type, using string", "type", name)
+			return "string", ""
+		}
+	}
+	if list := child(st, "list"); list != nil {
+		return "string", ""
+	}
+	restr := child(st, "restriction")
+	if restr == nil {
+		return "string", ""
+	}
+	var baseName xml.Name
+	base := "string"
+	if b := restr.Attr("", "base"); b != "" {
+		baseName = restr.Resolve(b)
+		base, _ = c.simpleType(baseName, nil)
+	} else if inner := child(restr, "simpleType"); inner != nil {
+		base, _ = c.simpleType(xml.Name{}, inner)
+	}
+	facet := func(nm string) int {
+		if f := child(restr, nm); f != nil {
+			n, _ := strconv.Atoi(f.Attr("", "value"))
+			return n
+		}
+		return 0
+	}
+	prec, scale := facet("totalDigits"), facet("fractionDigits")
+	switch {
+	case baseName == xml.Name{Space: xsdNS, Local: "decimal"}:
+		switch {
+		case prec == 0 || prec == 38 && scale == 0:
+			return "string", "NUMBER"
+		case scale == 0:
+			return intType(prec), "NUMBER(" + strconv.Itoa(prec) + ")"
+		}
+		return "string", "NUMBER(" + strconv.Itoa(prec) + ", " + strconv.Itoa(scale) + ")"
+	case base == "string":
+		if n := facet("maxLength"); n > 0 {
+			return "string", "VARCHAR2(" + strconv.Itoa(n) + ")"
+		}
+		if n := facet("length"); n > 0 {
+			return "string", "CHAR(" + strconv.Itoa(n) + ")"
+		}
+	case prec > 0 && strings.HasPrefix(strings.TrimPrefix(base, "u"), "int") || strings.HasPrefix(base, "sint"):
+		if prec > 0 {
+			return intType(prec), "NUMBER(" + strconv.Itoa(prec) + ")"
+		}
+	}
+	return base, ""
+}
+
+func intType(prec int) string {
+	switch {
+	case prec <= 9:
+		return "sint32"
+	case prec <= 18:
+		return "sint64"
+	}
+	return "string"
+}
+
+// builtinType returns the proto type of the XSD builtin type.
+func builtinType(name string) (string, string) {
+	switch name {
+	case "boolean":
+		return "bool", ""
+	case "int", "short", "byte":
+		return "sint32", ""
+	case "long", "integer", "nonNegativeInteger", "positiveInteger", "negativeInteger", "nonPositiveInteger":
+		return "sint64", ""
+	case "unsignedInt", "unsignedShort", "unsignedByte":
+		return "uint32", ""
+	case "unsignedLong":
+		return "uint64", ""
+	case "float":
+		return "float", ""
+	case "double":
+		return "double", ""
+	case "decimal":
+		return "string", "NUMBER"
+	case "dateTime":
+		return timestampType, ""
+	case "date":
+		return timestampType, "DATE"
+	case "base64Binary", "hexBinary":
+		return "bytes", ""
+	}
+	return "string", ""
+}
+
+func isRepeated(el *xmltree.Element) bool {
+	mo := el.Attr("", "maxOccurs")
+	if mo == "unbounded" {
+		return true
+	}
+	n, _ := strconv.Atoi(mo)
+	return n > 1
+}
+
+// isAny reports whether the complexType is just a sequence of xs:any.
+func isAny(ct *xmltree.Element) bool {
+	seq := child(ct, "sequence")
+	return seq != nil && len(seq.Children) == 1 &&
+		seq.Children[0].Name == xml.Name{Space: xsdNS, Local: "any"}
+}
+
+// child returns the first XSD child element named local.
+func child(el *xmltree.Element, local string) *xmltree.Element {
+	for i := range el.Children {
+		if ch := &el.Children[i]; ch.Name.Space == xsdNS && ch.Name.Local == local {
+			return ch
+		}
+	}
+	return nil
+}
+
+// documentation returns the text of the wsdl:documentation or xs:annotation/xs:documentation children.
+func documentation(el *xmltree.Element) string {
+	var parts []string
+	for i := range el.Children {
+		ch := &el.Children[i]
+		switch {
+		case ch.Name.Space == wsdlNS && ch.Name.Local == "documentation":
+			parts = append(parts, text(ch))
+		case ch.Name.Space == xsdNS && ch.Name.Local == "annotation":
+			for j := range ch.Children {
+				if d := &ch.Children[j]; d.Name.Space == xsdNS && d.Name.Local == "documentation" {
+					parts = append(parts, text(d))
+				}
+			}
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n"))
+}
+
+// text returns the unescaped character data of el.
+func text(el *xmltree.Element) string {
+	var buf strings.Builder
+	dec := xml.NewDecoder(bytes.NewReader(el.Content))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return string(el.Content)
+			}
+			break
+		}
+		if cd, ok := tok.(xml.CharData); ok {
+			buf.Write(cd)
+		}
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// derivePackage returns the snake_case form of the common prefix (before the first _) of the names,
+// if protoc-gen-wsdl would give back the same prefix; the snake_case form of the portType name otherwise.
+func derivePackage(portType string, names []string) string {
+	var prefix string
+	for i, nm := range names {
+		p, _, ok := strings.Cut(nm, "_")
+		if !ok || i != 0 && p != prefix {
+			prefix = ""
+			break
+		}
+		prefix = p
+	}
+	if pkg := snakeCase(prefix); prefix != "" && camelCase(pkg) == prefix {
+		return pkg
+	}
+	return snakeCase(portType)
+}
+
+// snakeCase is the inverse of camelCase, where possible.
+func snakeCase(s string) string {
+	var buf strings.Builder
+	var last rune
+	rs := []rune(s)
+	for i, r := range rs {
+		switch {
+		case r == '_':
+			if i+1 < len(rs) && unicode.IsDigit(rs[i+1]) {
+				buf.WriteByte('_')
+			} else {
+				buf.WriteString("__")
+			}
+		case unicode.IsUpper(r):
+			if i != 0 && last != '_' && !unicode.IsDigit(last) {
+				buf.WriteByte('_')
+			}
+			buf.WriteRune(unicode.ToLower(r))
+		default:
+			buf.WriteRune(r)
+		}
+		last = r
+	}
+	return buf.String()
+}
+
+var digitUnder = strings.NewReplacer(
+	"_0", "__0",
+	"_1", "__1",
+	"_2", "__2",
+	"_3", "__3",
+	"_4", "__4",
+	"_5", "__5",
+	"_6", "__6",
+	"_7", "__7",
+	"_8", "__8",
+	"_9", "__9",
+)
+
+// camelCase is protoc-gen-wsdl's CamelCase: the element name of the field name.
+func camelCase(text string) string {
+	if text == "" {
+		return text
+	}
+	text = digitUnder.Replace(text)
+	var last rune
+	return strings.Map(func(r rune) rune {
+		defer func() { last = r }()
+		if r == '_' {
+			if last != '_' {
+				return -1
+			}
+			return '_'
+		}
+		if last == 0 || last == '_' || '0' <= last && last <= '9' {
+			return unicode.ToUpper(r)
+		}
+		return unicode.ToLower(r)
+	},
+		text,
+	)
+}
+
+// mkTypeName is protoc-gen-wsdl's mkTypeName: the element name of the message.
+func mkTypeName(pkg, msg string) string {
+	s := camelCase(pkg) + "_" + msg
+	i := strings.IndexByte(s, '_')
+	if strings.HasPrefix(s[i+1:], s[:i+1]) {
+		s = s[i+1:]
+	}
+	return s
+}
+
+func comment(indent, s string) string {
+	if s == "" {
+		return ""
+	}
+	return indent + "// " + strings.ReplaceAll(s, "\n", "\n"+indent+"// ") + "\n"
+}
+
+var protoTemplate = template.Must(template.New("proto").
+	Funcs(template.FuncMap{"comment": comment}).
+	Parse(`syntax = "proto3";
+
+package {{.Package}};
+{{- if .GoPackage}}
+option go_package = "{{.GoPackage}}";
+{{- end}}
+{{- if .Timestamp}}
+import "google/protobuf/timestamp.proto";
+{{- end}}
+{{range .Messages}}
+{{comment "" .Doc}}message {{.Name}} {
+{{- range .Fields}}
+
+{{comment "\t" .Doc}}	{{if .Repeated}}repeated {{end}}{{.Type}} {{.Name}} = {{.Number}};
+{{- end}}
+}
+{{end}}
+{{comment "" .Service.Doc}}service {{.Service.Name}} {
+{{- range .Service.Methods}}
+{{if .Doc}}
+{{comment "\t" .Doc}}{{end}}	rpc {{.Name}} ({{.Input}}) returns ({{.Output}}) {}
+{{- end}}
+}
+`))
@@ -0,0 +1,66 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	wsdl, err := os.ReadFile("testdata/pgw.wsdl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Convert(Options{}, wsdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("testdata/pgw.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got\n%s\nwanted\n%s", got, want)
+	}
+
+	if got, err = Convert(Options{Package: "pgw", GoPackage: "example.com/pgw"}, wsdl); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Contains(got, []byte("package pgw;\noption go_package = \"example.com/pgw\";")) {
+		t.Errorf("package not set:\n%s", got)
+	}
+	if _, err = Convert(Options{PortType: "Other"}, wsdl); err == nil {
+		t.Error("wanted error for unknown portType")
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for _, nm := range []string{"PHibaKod", "PSzerzAzon", "URL", "Foo_Bar", "P_1", "Ab1", "DbWebGdpr"} {
+		if got := camelCase(snakeCase(nm)); got != nm {
+			t.Errorf("%q: got %q (%q)", nm, got, snakeCase(nm))
+		}
+	}
+	for _, tc := range []struct{ pkg, msg, want string }{
+		{"db_pgw_ws", "MoneyIn_Input", "DbPgwWs_MoneyIn_Input"},
+		{"db_pgw_ws", "DbPgwWs_MoneyIn_Input", "DbPgwWs_MoneyIn_Input"},
+		{"other", "DbPgwWs_MoneyIn_Input", "Other_DbPgwWs_MoneyIn_Input"},
+	} {
+		if got := mkTypeName(tc.pkg, tc.msg); got != tc.want {
+			t.Errorf("%s.%s: got %q, wanted %q", tc.pkg, tc.msg, got, tc.want)
+		}
+	}
+}
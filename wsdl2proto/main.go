@@ -0,0 +1,80 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Command wsdl2proto converts a WSDL's portType, messages and XSD types
+// into a .proto service definition, the reverse of protoc-gen-wsdl.
+//
+// Each operation becomes an rpc with <Operation>_Input and <Operation>_Output messages,
+// the element names become snake_case field names, and the XSD restrictions
+// are written as Oracle-type field comments (VARCHAR2(n), NUMBER(p, s), DATE),
+// such that protoc-gen-wsdl regenerates an equivalent WSDL.
+//
+// The names which protoc-gen-wsdl can't regenerate are logged as warnings.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+func main() {
+	if err := Main(); err != nil {
+		logger.Error("main", "error", err)
+		os.Exit(1)
+	}
+}
+
+func Main() error {
+	flagOut := flag.String("o", "", "output file (stdout by default)")
+	flagPkg := flag.String("package", "", "proto package (derived from the element names by default)")
+	flagGoPkg := flag.String("go_package", "", "go_package option")
+	flagPort := flag.String("port", "", "portType to convert (the first by default)")
+	flagVerbose := flag.Bool("v", false, "verbose logging")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n\t%s [options] service.wsdl [schema.xsd...]\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return fmt.Errorf("WSDL file is required")
+	}
+	if *flagVerbose {
+		logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+
+	docs := make([][]byte, 0, flag.NArg())
+	for _, fn := range flag.Args() {
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, b)
+	}
+	b, err := Convert(Options{Package: *flagPkg, GoPackage: *flagGoPkg, PortType: strings.TrimSpace(*flagPort)}, docs...)
+	if err != nil {
+		return err
+	}
+	if *flagOut == "" || *flagOut == "-" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(*flagOut, b, 0644)
+}
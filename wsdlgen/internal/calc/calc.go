@@ -0,0 +1,98 @@
+// Code generated by wsdlgen. DO NOT EDIT.
+
+package calc
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+
+	soapproxy "github.com/UNO-SOFT/soap-proxy"
+)
+
+type Anon1 struct {
+	Dividend int `xml:"urn:calc Dividend"`
+}
+
+type DivideInput struct {
+	A int `xml:"urn:calc A"`
+	B int `xml:"urn:calc B"`
+}
+
+type DivideOutput struct {
+	Quotient  int `xml:"urn:calc Quotient"`
+	Remainder int `xml:"urn:calc Remainder"`
+}
+
+type DivisionByZero struct {
+	Dividend int `xml:"urn:calc Dividend"`
+}
+
+// Fault is a SOAP fault returned by the service.
+type Fault = soapproxy.FaultError
+
+func asFault(err error) *Fault {
+	var fault *Fault
+	if errors.As(err, &fault) {
+		return fault
+	}
+	return nil
+}
+
+// DivisionByZeroError is the DivisionByZero fault.
+type DivisionByZeroError struct {
+	*Fault
+	Detail DivisionByZero
+}
+
+func (e *DivisionByZeroError) Unwrap() error { return e.Fault }
+
+// call the action on c with the req encoded as the name element, decoding the response into resp.
+//
+// A SOAP fault (even in a successful response) is returned as a *Fault.
+func call(ctx context.Context, c *soapproxy.Client, action string, name xml.Name, req, resp any) error {
+	var buf strings.Builder
+	if err := xml.NewEncoder(&buf).EncodeElement(req, xml.StartElement{Name: name}); err != nil {
+		return fmt.Errorf("encode %s: %w", name.Local, err)
+	}
+	return c.Call(ctx, action, buf.String(), resp)
+}
+
+// CalcClient is the client of the Calc portType.
+type CalcClient struct {
+	// Client calls the service: its URL, HTTPClient, SOAPHeader, Logger etc. configure the calls.
+	Client *soapproxy.Client
+}
+
+// NewCalcClient returns a new client calling url, or http://localhost:8080/calc if empty.
+func NewCalcClient(url string) *CalcClient {
+	if url == "" {
+		url = "http://localhost:8080/calc"
+	}
+	return &CalcClient{Client: &soapproxy.Client{URL: url}}
+}
+
+// Divide calls the Divide operation.
+//
+// Divide A by B.
+//
+// The declared faults are returned as *DivisionByZeroError.
+func (c *CalcClient) Divide(ctx context.Context, req *DivideInput) (*DivideOutput, error) {
+	var resp DivideOutput
+	if err := call(ctx, c.Client, "urn:calc/Divide", xml.Name{Space: "urn:calc", Local: "Divide_Input"}, req, &resp); err != nil {
+		if fault := asFault(err); fault != nil {
+			switch fault.DetailName {
+			case xml.Name{Space: "urn:calc", Local: "DivisionByZero"}:
+				e := &DivisionByZeroError{Fault: fault}
+				if derr := fault.DecodeDetail(&e.Detail); derr != nil {
+					return nil, errors.Join(err, derr)
+				}
+				return nil, e
+			}
+		}
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package calc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get("SOAPAction"); got != "urn:calc/Divide" {
+			t.Errorf("got SOAPAction %q", got)
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		if strings.Contains(string(b), "<B xmlns=\"urn:calc\">0</B>") {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:c="urn:calc"><soapenv:Body>
+<soapenv:Fault><faultcode>soapenv:Client</faultcode><faultstring>division by zero</faultstring>
+<detail><c:DivisionByZero><c:Dividend>7</c:Dividend></c:DivisionByZero></detail></soapenv:Fault>
+</soapenv:Body></soapenv:Envelope>`)
+			return
+		}
+		io.WriteString(w, `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body>
+<Divide_Output xmlns="urn:calc"><Quotient>3</Quotient><Remainder>1</Remainder></Divide_Output>
+</soapenv:Body></soapenv:Envelope>`)
+	}))
+	defer srv.Close()
+
+	c := NewCalcClient(srv.URL)
+	c.Client.Logger = zlog.NewT(t).SLog()
+	var header string
+	c.Client.SOAPHeader = func(_ context.Context, action string) (string, error) {
+		header = action
+		return "", nil
+	}
+	ctx := context.Background()
+	resp, err := c.Divide(ctx, &DivideInput{A: 7, B: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Quotient != 3 || resp.Remainder != 1 {
+		t.Errorf("got %+v", resp)
+	}
+	if header != "urn:calc/Divide" {
+		t.Errorf("SOAPHeader got %q", header)
+	}
+
+	_, err = c.Divide(ctx, &DivideInput{A: 7, B: 0})
+	var dbz *DivisionByZeroError
+	if !errors.As(err, &dbz) {
+		t.Fatalf("wanted DivisionByZeroError, got %#v", err)
+	}
+	if dbz.Detail.Dividend != 7 || dbz.String != "division by zero" {
+		t.Errorf("got %+v", dbz)
+	}
+	var fault *Fault
+	if !errors.As(err, &fault) || fault.Code != "soapenv:Client" {
+		t.Errorf("wanted Fault, got %+v", fault)
+	}
+}
@@ -1,14 +1,510 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Command wsdlgen generates a typed Go client from a WSDL.
+//
+// The types are generated by aqwari.net/xml/xsdgen, and for each portType
+// a <PortType>Client with a method per operation, taking the request and
+// returning the response struct, calling through its *soapproxy.Client
+// (with its retries, logging and metrics).
+// The declared wsdl:fault messages are returned as typed errors.
+//
+// Only document/literal operations with single element parts are supported,
+// the others are skipped with a warning.
 package main
 
 import (
-	"log"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"log/slog"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"aqwari.net/xml/xmltree"
+	"aqwari.net/xml/xsd"
+	"aqwari.net/xml/xsdgen"
+)
 
-	"aqwari.net/xml/wsdlgen"
+const (
+	wsdlNS   = "http://schemas.xmlsoap.org/wsdl/"
+	soapNS   = "http://schemas.xmlsoap.org/wsdl/soap/"
+	soap12NS = "http://schemas.xmlsoap.org/wsdl/soap12/"
 )
 
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
 func main() {
-	if err := wsdlgen.GenCLI(os.Args[1:]...); err != nil {
-		log.Fatal(err)
+	if err := Main(); err != nil {
+		logger.Error("main", "error", err)
+		os.Exit(1)
+	}
+}
+
+func Main() error {
+	flagOut := flag.String("o", "", "output file (stdout by default)")
+	flagPkg := flag.String("pkg", "ws", "package name of the generated code")
+	flagPort := flag.String("port", "", "comma-separated list of the portTypes to generate clients for (all by default)")
+	flagVerbose := flag.Bool("v", false, "verbose logging")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n\t%s [options] service.wsdl [schema.xsd...]\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return errors.New("WSDL file is required")
+	}
+	if *flagVerbose {
+		logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+
+	docs := make([][]byte, 0, flag.NArg())
+	for _, fn := range flag.Args() {
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, b)
+	}
+	var ports []string
+	if *flagPort != "" {
+		ports = strings.Split(*flagPort, ",")
+	}
+	src, err := Generate(*flagPkg, ports, docs...)
+	if err != nil {
+		return err
+	}
+	if *flagOut == "" || *flagOut == "-" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(*flagOut, src, 0644)
+}
+
+// Generate the Go source of package pkg for the WSDL (docs[0]) and the additional schemas.
+//
+// If ports is not empty, only those portTypes' clients are generated.
+func Generate(pkg string, ports []string, docs ...[]byte) ([]byte, error) {
+	if len(docs) == 0 {
+		return nil, errors.New("no WSDL given")
+	}
+	root, err := xmltree.Parse(docs[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse WSDL: %w", err)
+	}
+	var cfg xsdgen.Config
+	cfg.Option(xsdgen.DefaultOptions...)
+	cfg.Option(xsdgen.PackageName(pkg))
+	code, err := cfg.GenCode(docs...)
+	if err != nil {
+		return nil, fmt.Errorf("generate types: %w", err)
+	}
+
+	g := generator{code: code, root: root,
+		targetNS: root.Attr("", "targetNamespace"),
+		faults:   make(map[xml.Name]*fault),
+	}
+	portTypes, err := g.portTypes(ports)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := code.GenAST()
+	if err != nil {
+		return nil, fmt.Errorf("generate types: %w", err)
+	}
+	file.Name = ast.NewIdent(pkg)
+	var buf bytes.Buffer
+	fset := token.NewFileSet()
+	if err = printer.Fprint(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return g.source(pkg, buf.Bytes(), portTypes)
+}
+
+type generator struct {
+	code     *xsdgen.Code
+	root     *xmltree.Element
+	faults   map[xml.Name]*fault
+	targetNS string
+}
+
+type portType struct {
+	Name, Doc, Address string
+	Operations         []operation
+}
+
+type operation struct {
+	Name, Doc, Action string
+	Input             xml.Name
+	InputType         string
+	OutputType        string
+	Faults            []*fault
+}
+
+type fault struct {
+	Message    string
+	Element    xml.Name
+	DetailType string
+}
+
+// GoName returns the exported Go identifier of the name.
+func (p portType) GoName() string { return goName(p.Name) }
+
+// GoName returns the exported Go identifier of the name.
+func (op operation) GoName() string { return goName(op.Name) }
+
+// ErrorType returns the name of the error type of the fault.
+func (f fault) ErrorType() string { return goName(f.Message) + "Error" }
+
+// portTypes returns the portTypes bound by a SOAP 1.1 binding of a service port.
+func (g *generator) portTypes(only []string) ([]portType, error) {
+	bindings := make(map[xml.Name]*xmltree.Element)
+	for _, b := range g.root.Search(wsdlNS, "binding") {
+		if len(b.Search(soapNS, "binding")) != 0 {
+			bindings[b.ResolveDefault(b.Attr("", "name"), g.targetNS)] = b
+		} else if len(b.Search(soap12NS, "binding")) != 0 {
+			logger.Warn("SOAP 1.2 binding is not supported", "binding", b.Attr("", "name"))
+		}
+	}
+	var ports []portType
+	seen := make(map[xml.Name]bool)
+	for _, port := range g.root.Search(wsdlNS, "port") {
+		bind := bindings[port.Resolve(port.Attr("", "binding"))]
+		if bind == nil {
+			continue
+		}
+		ptName := bind.Resolve(bind.Attr("", "type"))
+		if seen[ptName] || len(only) != 0 && !slices.Contains(only, ptName.Local) {
+			continue
+		}
+		seen[ptName] = true
+		pts := g.root.SearchFunc(func(el *xmltree.Element) bool {
+			return el.Name.Space == wsdlNS && el.Name.Local == "portType" &&
+				el.ResolveDefault(el.Attr("", "name"), g.targetNS) == ptName
+		})
+		if len(pts) == 0 {
+			return nil, fmt.Errorf("portType %s of binding %s not found", ptName.Local, bind.Attr("", "name"))
+		}
+		pt := portType{Name: ptName.Local, Doc: documentation(pts[0])}
+		for _, addr := range port.Search(soapNS, "address") {
+			pt.Address = addr.Attr("", "location")
+		}
+		for _, op := range pts[0].Search(wsdlNS, "operation") {
+			o, err := g.operation(bind, op)
+			if err != nil {
+				logger.Warn("skip operation", "portType", pt.Name, "operation", op.Attr("", "name"), "error", err)
+				continue
+			}
+			pt.Operations = append(pt.Operations, o)
+		}
+		ports = append(ports, pt)
+	}
+	if len(ports) == 0 {
+		return nil, errors.New("no SOAP 1.1 port found")
+	}
+	return ports, nil
+}
+
+func (g *generator) operation(bind, op *xmltree.Element) (operation, error) {
+	o := operation{Name: op.Attr("", "name"), Doc: documentation(op)}
+	for _, bop := range bind.Search(wsdlNS, "operation") {
+		if bop.Attr("", "name") != o.Name {
+			continue
+		}
+		for _, soapOp := range bop.Search(soapNS, "operation") {
+			o.Action = soapOp.Attr("", "soapAction")
+			if style := soapOp.Attr("", "style"); style == "rpc" {
+				return o, errors.New("rpc style is not supported")
+			}
+		}
+	}
+	for _, inp := range op.Search(wsdlNS, "input") {
+		elt, typ, err := g.messageElement(inp.Resolve(inp.Attr("", "message")))
+		if err != nil {
+			return o, fmt.Errorf("input: %w", err)
+		}
+		o.Input, o.InputType = elt, typ
+	}
+	for _, out := range op.Search(wsdlNS, "output") {
+		_, typ, err := g.messageElement(out.Resolve(out.Attr("", "message")))
+		if err != nil {
+			return o, fmt.Errorf("output: %w", err)
+		}
+		o.OutputType = typ
+	}
+	if o.InputType == "" || o.OutputType == "" {
+		return o, errors.New("only request-response operations are supported")
+	}
+	for _, f := range op.Search(wsdlNS, "fault") {
+		msg := f.Resolve(f.Attr("", "message"))
+		if flt := g.faults[msg]; flt != nil {
+			o.Faults = append(o.Faults, flt)
+			continue
+		}
+		elt, typ, err := g.messageElement(msg)
+		if err != nil {
+			return o, fmt.Errorf("fault %s: %w", msg.Local, err)
+		}
+		flt := &fault{Message: msg.Local, Element: elt, DetailType: typ}
+		g.faults[msg] = flt
+		o.Faults = append(o.Faults, flt)
+	}
+	return o, nil
+}
+
+// messageElement returns the element and its Go type of the message's sole part.
+func (g *generator) messageElement(name xml.Name) (xml.Name, string, error) {
+	msgs := g.root.SearchFunc(func(el *xmltree.Element) bool {
+		return el.Name.Space == wsdlNS && el.Name.Local == "message" &&
+			el.ResolveDefault(el.Attr("", "name"), g.targetNS) == name
+	})
+	if len(msgs) == 0 {
+		return xml.Name{}, "", fmt.Errorf("message %s not found", name.Local)
+	}
+	parts := msgs[0].Search(wsdlNS, "part")
+	if len(parts) != 1 {
+		return xml.Name{}, "", fmt.Errorf("message %s has %d parts, only single-part messages are supported", name.Local, len(parts))
+	}
+	if parts[0].Attr("", "element") == "" {
+		return xml.Name{}, "", fmt.Errorf("message %s: only element parts are supported", name.Local)
+	}
+	elt := parts[0].Resolve(parts[0].Attr("", "element"))
+	doc, ok := g.code.DocType(elt.Space)
+	if !ok {
+		return elt, "", fmt.Errorf("no schema for %s", elt.Space)
+	}
+	for _, el := range doc.Elements {
+		if el.Name != elt {
+			continue
+		}
+		typName := xsd.XMLName(el.Type)
+		if strings.HasPrefix(typName.Local, "_anon") {
+			// anonymous types are generated with the element's name
+			typName = elt
+		}
+		typ := g.code.NameOf(typName)
+		if strings.HasPrefix(typ, "NOTFOUND") || strings.HasPrefix(typ, "ERROR") {
+			return elt, "", fmt.Errorf("no type for element %s", elt.Local)
+		}
+		return elt, typ, nil
+	}
+	return elt, "", fmt.Errorf("element %s not found", elt.Local)
+}
+
+func documentation(el *xmltree.Element) string {
+	var docs []string
+	for _, d := range el.Children {
+		if d.Name.Space == wsdlNS && d.Name.Local == "documentation" {
+			if s := strings.TrimSpace(string(d.Content)); s != "" {
+				docs = append(docs, s)
+			}
+		}
+	}
+	return strings.Join(docs, "\n")
+}
+
+// source merges the imports of the types with the client's, and appends the client code.
+func (g *generator) source(pkg string, types []byte, ports []portType) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "types.go", types, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parse generated types: %w", err)
+	}
+	imports := []string{
+		"context", "encoding/xml", "errors", "fmt", "strings",
+		"github.com/UNO-SOFT/soap-proxy",
+	}
+	bodyStart := file.Name.End()
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			path, _ := strconv.Unquote(spec.(*ast.ImportSpec).Path.Value)
+			if !slices.Contains(imports, path) {
+				imports = append(imports, path)
+			}
+		}
+		bodyStart = gd.End()
+	}
+	slices.Sort(imports)
+
+	var buf bytes.Buffer
+	if err = clientTemplate.Execute(&buf, struct {
+		Package string
+		Imports []string
+		Types   string
+		Ports   []portType
+		Faults  []*fault
+	}{Package: pkg, Imports: imports, Ports: ports,
+		Types:  string(types[fset.Position(bodyStart).Offset:]),
+		Faults: g.sortedFaults(),
+	}); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return buf.Bytes(), fmt.Errorf("format generated code: %w", err)
+	}
+	return src, nil
+}
+
+func (g *generator) sortedFaults() []*fault {
+	faults := make([]*fault, 0, len(g.faults))
+	for _, f := range g.faults {
+		faults = append(faults, f)
+	}
+	slices.SortFunc(faults, func(a, b *fault) int { return strings.Compare(a.Message, b.Message) })
+	return faults
+}
+
+// goName returns the exported Go identifier of s: the letters and digits, in CamelCase.
+func goName(s string) string {
+	var buf strings.Builder
+	upper := true
+	for _, r := range s {
+		if !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			upper = true
+			continue
+		}
+		if buf.Len() == 0 && unicode.IsDigit(r) {
+			buf.WriteByte('X')
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+func comment(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "\n//\n// " + strings.ReplaceAll(strings.TrimSpace(s), "\n", "\n// ")
+}
+
+var clientTemplate = template.Must(template.New("client").
+	Funcs(template.FuncMap{
+		"comment": comment, "quote": strconv.Quote,
+		"isThirdParty": func(path string) bool { return strings.Contains(strings.Split(path, "/")[0], ".") },
+	}).
+	Parse(`// Code generated by wsdlgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}{{if not (isThirdParty .)}}
+	{{quote .}}
+{{- end}}{{end}}
+{{range .Imports}}{{if isThirdParty .}}
+	{{if eq . "github.com/UNO-SOFT/soap-proxy"}}soapproxy {{end}}{{quote .}}
+{{- end}}{{end}}
+)
+
+{{.Types}}
+
+// Fault is a SOAP fault returned by the service.
+type Fault = soapproxy.FaultError
+
+func asFault(err error) *Fault {
+	var fault *Fault
+	if errors.As(err, &fault) {
+		return fault
+	}
+	return nil
+}
+{{range .Faults}}
+// {{.ErrorType}} is the {{.Message}} fault.
+type {{.ErrorType}} struct {
+	*Fault
+	Detail {{.DetailType}}
+}
+
+func (e *{{.ErrorType}}) Unwrap() error { return e.Fault }
+{{end}}
+// call the action on c with the req encoded as the name element, decoding the response into resp.
+//
+// A SOAP fault (even in a successful response) is returned as a *Fault.
+func call(ctx context.Context, c *soapproxy.Client, action string, name xml.Name, req, resp any) error {
+	var buf strings.Builder
+	if err := xml.NewEncoder(&buf).EncodeElement(req, xml.StartElement{Name: name}); err != nil {
+		return fmt.Errorf("encode %s: %w", name.Local, err)
+	}
+	return c.Call(ctx, action, buf.String(), resp)
+}
+{{range $port := .Ports}}
+// {{.GoName}}Client is the client of the {{.Name}} portType.
+{{- comment .Doc}}
+type {{.GoName}}Client struct {
+	// Client calls the service: its URL, HTTPClient, SOAPHeader, Logger etc. configure the calls.
+	Client *soapproxy.Client
+}
+
+// New{{.GoName}}Client returns a new client calling url{{if .Address}}, or {{.Address}} if empty{{end}}.
+func New{{.GoName}}Client(url string) *{{.GoName}}Client {
+{{- if .Address}}
+	if url == "" {
+		url = {{quote .Address}}
+	}
+{{- end}}
+	return &{{.GoName}}Client{Client: &soapproxy.Client{URL: url}}
+}
+{{range .Operations}}
+// {{.GoName}} calls the {{.Name}} operation.
+{{- comment .Doc}}
+{{- if .Faults}}
+//
+// The declared faults are returned as{{range $i, $f := .Faults}}{{if $i}},{{end}} *{{$f.ErrorType}}{{end}}.
+{{- end}}
+func (c *{{$port.GoName}}Client) {{.GoName}}(ctx context.Context, req *{{.InputType}}) (*{{.OutputType}}, error) {
+	var resp {{.OutputType}}
+	if err := call(ctx, c.Client, {{quote .Action}}, xml.Name{Space: {{quote .Input.Space}}, Local: {{quote .Input.Local}}}, req, &resp); err != nil {
+{{- if .Faults}}
+		if fault := asFault(err); fault != nil {
+			switch fault.DetailName {
+{{- range .Faults}}
+			case xml.Name{Space: {{quote .Element.Space}}, Local: {{quote .Element.Local}}}:
+				e := &{{.ErrorType}}{Fault: fault}
+				if derr := fault.DecodeDetail(&e.Detail); derr != nil {
+					return nil, errors.Join(err, derr)
+				}
+				return nil, e
+{{- end}}
+			}
+		}
+{{- end}}
+		return nil, err
 	}
+	return &resp, nil
 }
+{{end}}
+{{- end}}`))
@@ -0,0 +1,44 @@
+// Copyright 2026 Tamás Gulácsi
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	wsdl, err := os.ReadFile("testdata/calc.wsdl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Generate("calc", nil, wsdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("internal/calc/calc.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("generated code differs from internal/calc/calc.go, run go generate ./internal/calc:\n%s", got)
+	}
+
+	if _, err = Generate("calc", []string{"Other"}, wsdl); err == nil {
+		t.Error("wanted error for unknown portType")
+	}
+}